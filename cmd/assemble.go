@@ -5,10 +5,10 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 	"os"
-	"path"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -41,14 +41,26 @@ var assembleCmd = &cobra.Command{
 		}
 
 		ctx := context.Background()
+		databaseForOrb := func(orbName string) string { return orbName }
+
+		if dbReset {
+			err = guardDatabaseReset(ctx, cluster, orbs, databaseForOrb, resetBackup)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
 		log.Debug("Capturing orbs", "orbs", orbs)
-		assembleOrbs(
+		err = assembleOrbs(
 			ctx,
 			cluster,
 			dbReset,
 			orbs,
-			func(orbName string) string { return orbName },
+			databaseForOrb,
 		)
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -65,42 +77,64 @@ func assembleOrbs(
     log.Error("Could not connect to orb. Ensure the docker container is running, perhaps 'omnigres start' will fix it.")
 		return
 	}
-	for _, orbName := range orbs {
-		log.Infof("Assembling orb %s", orbName)
+	defer db.Close()
+	err = checkExtensionsAvailable(ctx, db, cluster, orbs)
+	if err != nil {
+		return
+	}
+	assembleOrb := func(orbName string) (err error) {
 		dbName := databaseForOrb(orbName)
 		var dbExists bool
-		err := db.QueryRowContext(
+		err = db.QueryRowContext(
 			ctx,
 			`select exists(select from pg_database where datname = $1)`,
 			dbName,
 		).Scan(&dbExists)
 		if err != nil {
-			log.Fatal(err)
+			return
 		}
 
 		if dbReset && dbExists {
-			if err != sql.ErrNoRows {
-				_, err = db.ExecContext(ctx, fmt.Sprintf(`drop database %q`, dbName))
-				if err != nil {
-					log.Fatal(err)
-				}
+			_, err = db.ExecContext(ctx, fmt.Sprintf(`drop database %q`, dbName))
+			if err != nil {
+				return
 			}
 		}
 
 		if dbReset || !dbExists {
 			_, err = db.ExecContext(ctx, fmt.Sprintf(`create database %q`, dbName))
 			if err != nil {
-				log.Fatal(err)
+				return
 			}
 		}
 
-		orbSource := path.Join(orbName, "src")
-		assembleSchema(ctx, db, orbSource, dbName)
+		err = installExtensions(ctx, cluster, orbName, dbName)
+		if err != nil {
+			return
+		}
+
+		return assembleSchema(ctx, db, cluster.OrbPath(orbName), "src", dbName)
 	}
+
+	// Orbs failing to assemble don't prevent others from being assembled
+	var failures []error
+	for _, orbName := range orbs {
+		log.Infof("Assembling orb %s", orbName)
+		err = assembleOrb(orbName)
+		if err != nil {
+			err = fmt.Errorf("could not assemble orb %s: %w", orbName, err)
+			log.Error(err)
+			failures = append(failures, err)
+		}
+	}
+	err = errors.Join(failures...)
 	return
 }
 
-func assembleSchema(ctx context.Context, db *sql.DB, orbSource string, dbName string) {
+// assembleSchema assembles the schema from the source directory, relative to
+// orbDir (a directory inside the cluster), into the database. It fails if
+// any statement could not be executed.
+func assembleSchema(ctx context.Context, db *sql.DB, orbDir string, source string, dbName string) (err error) {
 	logger := log.New(os.Stdout)
 	logger.SetReportTimestamp(true)
 
@@ -131,9 +165,10 @@ func assembleSchema(ctx context.Context, db *sql.DB, orbSource string, dbName st
 		logger.Log(levels[message["type"].(string)], message["message"], tags...)
 	}
 
-	conn, err := db.Conn(ctx)
+	var conn *sql.Conn
+	conn, err = db.Conn(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return
 	}
 	defer conn.Close()
 	conn.Raw(func(driverConn any) error {
@@ -141,28 +176,36 @@ func assembleSchema(ctx context.Context, db *sql.DB, orbSource string, dbName st
 		return nil
 	})
 
-	rows, err := conn.QueryContext(ctx,
-		`select migration_filename, migration_statement, execution_error from omni_schema.assemble_schema($1, omni_vfs.local_fs('/mnt/host'), $2) where execution_error is not null`,
-		fmt.Sprintf("dbname=%s user=omnigres", dbName), orbSource)
+	var rows *sql.Rows
+	rows, err = conn.QueryContext(ctx,
+		`select migration_filename, migration_statement, execution_error from omni_schema.assemble_schema($1, omni_vfs.local_fs($2), $3) where execution_error is not null`,
+		fmt.Sprintf("dbname=%s user=omnigres", dbName), orbDir, source)
 
 	if err != nil {
-		log.Fatal(err)
+		return
 	}
 	defer rows.Close()
 
+	failed := 0
 	for rows.Next() {
 		var migration_filename, migration_statement, execution_error sql.NullString
 		err = rows.Scan(&migration_filename, &migration_statement, &execution_error)
 		if err != nil {
-			log.Error(err)
 			return
 		}
+		failed++
 	}
+	if failed > 0 {
+		err = fmt.Errorf("%d statement(s) of %s failed to assemble into %s", failed, source, dbName)
+	}
+	return
 }
 
 var dbReset bool
+var resetBackup bool
 
 func init() {
 	rootCmd.AddCommand(assembleCmd)
-	assembleCmd.Flags().BoolVarP(&dbReset, "dbReset", "r", false, "dbReset")
+	assembleCmd.Flags().BoolVarP(&dbReset, "dbReset", "r", false, "drop and recreate orb databases (asks for confirmation)")
+	assembleCmd.Flags().BoolVar(&resetBackup, "backup", false, "dump databases into the workspace's backups directory before dropping them")
 }
@@ -102,12 +102,17 @@ func captureSchemaRevision(
 	err = conn.QueryRowContext(
 		ctx,
 		`select omni_schema.capture_schema_revision(omni_vfs.local_fs($1), 'src', 'revisions')`,
-		fmt.Sprintf("/mnt/host/%s", orbName),
+		cluster.OrbPath(orbName),
 	).Scan(&revision)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	err = ensureDisposableDatabase(cluster, revision)
+	if err != nil {
+		log.Errorf("Revision %s created, but its database was kept: %v", revision, err)
+		return
+	}
 	_, err = db.ExecContext(ctx, fmt.Sprintf("drop database \"%s\"", revision))
 	if err != nil {
 		log.Errorf("Could not remove revision. You can try to manually remove using DROP DATABASE %s", revision)
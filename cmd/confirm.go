@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var errNoTerminal = errors.New("can't ask for confirmation without a terminal, pass --yes to proceed")
+
+// confirm asks the user a yes/no question.
+//
+// It answers yes without asking when --yes was given, and fails when there's
+// no terminal to ask on, so scripts have to opt in explicitly.
+func confirm(question string) (ok bool, err error) {
+	if assumeYes {
+		ok = true
+		return
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		err = errNoTerminal
+		return
+	}
+	fmt.Printf("%s [y/N] ", question)
+	var answer string
+	answer, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	ok = answer == "y" || answer == "yes"
+	return
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/lib/pq"
+	"github.com/omnigres/cli/orb"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Remove the cluster",
+	Long: `Removes the cluster's container and omnigres.run.yaml, as well as the
+workspace's network (omnigres-<workspace>) when no other cluster uses it.
+
+With --test-databases, test databases left behind by interrupted
+'omnigres test' runs are dropped first. This matters when the data is kept
+in a volume, which is only removed with --volumes.
+
+Asks for confirmation unless --yes is given. When the cluster's data would
+be lost (there's no volume, or --volumes is given), workspaces with
+protected orbs are refused.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		volume := cluster.Config().Volume
+		// Without a volume, the data lives in the container
+		if volume == "" || downVolumes {
+			for _, orbCfg := range cluster.Config().Orbs {
+				if orbCfg.Protected {
+					log.Fatalf("Orb %s is protected, refusing to remove the cluster with its data", orbCfg.Name)
+				}
+			}
+		}
+
+		question := fmt.Sprintf("Remove the cluster? Its data is kept in volume %s.", volume)
+		switch {
+		case volume == "":
+			question = "Remove the cluster with all its data?"
+		case downVolumes:
+			question = fmt.Sprintf("Remove the cluster and volume %s with all its data?", volume)
+		}
+		var ok bool
+		ok, err = confirm(question)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			log.Fatal("Aborted")
+		}
+
+		ctx := context.Background()
+
+		if downTestDatabases {
+			err = dropTestDatabases(ctx, cluster)
+			if err != nil {
+				log.Error("Could not drop test databases, is the cluster running?", "err", err)
+			}
+		}
+
+		err = cluster.Down(ctx, downVolumes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Cluster removed")
+	},
+}
+
+// dropTestDatabases drops databases created by `omnigres test` for the configured orbs
+func dropTestDatabases(ctx context.Context, cluster orb.OrbCluster) (err error) {
+	var db *sql.DB
+	db, err = cluster.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	names := lo.Map(cluster.Config().Orbs, func(o orb.OrbCfg, _ int) string { return regexp.QuoteMeta(o.Name) })
+	if len(names) == 0 {
+		return
+	}
+	pattern := fmt.Sprintf(`^(%s)_test_\d{14}$`, strings.Join(names, "|"))
+
+	var rows *sql.Rows
+	rows, err = db.QueryContext(ctx, `select datname from pg_database where datname ~ $1`, pattern)
+	if err != nil {
+		return
+	}
+	var databases []string
+	for rows.Next() {
+		var datname string
+		if err = rows.Scan(&datname); err != nil {
+			rows.Close()
+			return
+		}
+		databases = append(databases, datname)
+	}
+	rows.Close()
+
+	for _, dbName := range databases {
+		err = ensureDisposableDatabase(cluster, dbName)
+		if err != nil {
+			return
+		}
+		log.Info("Dropping test database", "database", dbName)
+		_, err = db.ExecContext(ctx, "update pg_database set datistemplate = false where datname = $1", dbName)
+		if err != nil {
+			return
+		}
+		_, err = db.ExecContext(ctx, fmt.Sprintf("drop database %s", pq.QuoteIdentifier(dbName)))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+var downVolumes bool
+var downTestDatabases bool
+
+func init() {
+	rootCmd.AddCommand(downCmd)
+	downCmd.Flags().BoolVar(&downVolumes, "volumes", false, "remove the data volume")
+	downCmd.Flags().BoolVar(&downTestDatabases, "test-databases", false, "drop test databases left behind by interrupted test runs")
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Show the cluster's environment",
+	Long: `Shows the environment passed to the cluster's container, with values masked.
+
+Variables come from (in increasing precedence):
+
+  - .env of the workspace and <orb>/.env
+  - env of omnigres.yaml and of its orbs
+  - secrets of omnigres.yaml and of its orbs (name: file)
+  - host variables prefixed with the orb name
+
+Variables of orbs are prefixed with the orb name (<ORB>_<NAME>).
+The environment is set when the container is created.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var env []orb.EnvVar
+		env, err = cluster.Environment()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		rows := make([][]string, 0)
+		for _, e := range env {
+			value := e.Value
+			if !revealEnv || e.Secret {
+				value = maskValue(value)
+			}
+			rows = append(rows, []string{e.Name, value, e.Source})
+		}
+
+		t := table.New().
+			Border(lipgloss.RoundedBorder()).
+			BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99"))).
+			Headers("Name", "Value", "Source").
+			Rows(rows...)
+
+		fmt.Println(t)
+
+		var changed bool
+		changed, err = cluster.EnvironmentChanged(context.Background())
+		if err != nil {
+			log.Warn("Could not compare with the container's environment", "err", err)
+		} else if changed {
+			log.Warn("The environment has changed since the container was created, 'omnigres start' will offer to recreate it")
+		}
+	},
+}
+
+// maskValue hides a value, showing whether it is set
+func maskValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "********"
+}
+
+var revealEnv bool
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.Flags().BoolVar(&revealEnv, "reveal", false, "show values, except for secrets")
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var extensionCmd = &cobra.Command{
+	Use:   "extension",
+	Short: "Extension management",
+}
+
+var extensionOrbs []string
+
+// extensionTargetOrbs returns the orbs selected with --orb, or the current
+// orbs if none were selected
+func extensionTargetOrbs(cluster orb.OrbCluster) (orbs []string, err error) {
+	if len(extensionOrbs) > 0 {
+		for _, orbName := range extensionOrbs {
+			if _, ok := cluster.Config().Orb(orbName); !ok {
+				err = fmt.Errorf("orb %s is not configured in this workspace", orbName)
+				return
+			}
+		}
+		orbs = extensionOrbs
+		return
+	}
+
+	var cwd string
+	cwd, err = os.Getwd()
+	if err != nil {
+		return
+	}
+	return currentOrbs(cluster, cwd)
+}
+
+func init() {
+	rootCmd.AddCommand(extensionCmd)
+	extensionCmd.AddCommand(extensionListCmd)
+	extensionCmd.AddCommand(extensionAddCmd)
+	extensionCmd.AddCommand(extensionRemoveCmd)
+	extensionCmd.AddCommand(extensionUpgradeCmd)
+	extensionCmd.PersistentFlags().StringSliceVar(&extensionOrbs, "orb", nil, "orbs to operate on (defaults to current orbs)")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var extensionAddCmd = &cobra.Command{
+	Use:   "add extension[@version]...",
+	Short: "Add extensions to orbs",
+	Long: `Adds extensions to the orbs' configuration in omnigres.yaml.
+
+If an extension is already listed, its version pin is replaced. Extensions
+are installed next time the orb is assembled, migrated or tested.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		orbs, err := extensionTargetOrbs(cluster)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg := cluster.Config()
+		for i := range cfg.Orbs {
+			if !lo.Contains(orbs, cfg.Orbs[i].Name) {
+				continue
+			}
+			for _, spec := range args {
+				ext := orb.ParseExtension(spec)
+				cfg.Orbs[i].Extensions = append(withoutExtension(cfg.Orbs[i].Extensions, ext.Name), ext.String())
+				log.Infof("Added extension %s to orb %s", ext, cfg.Orbs[i].Name)
+			}
+		}
+
+		err = cfg.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var extensionRemoveCmd = &cobra.Command{
+	Use:   "remove extension...",
+	Short: "Remove extensions from orbs",
+	Long: `Removes extensions from the orbs' configuration in omnigres.yaml.
+
+Extensions that are already installed in orb databases are left in place.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		orbs, err := extensionTargetOrbs(cluster)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg := cluster.Config()
+		for i := range cfg.Orbs {
+			if !lo.Contains(orbs, cfg.Orbs[i].Name) {
+				continue
+			}
+			for _, spec := range args {
+				ext := orb.ParseExtension(spec)
+				extensions := withoutExtension(cfg.Orbs[i].Extensions, ext.Name)
+				if len(extensions) != len(cfg.Orbs[i].Extensions) {
+					log.Infof("Removed extension %s from orb %s", ext.Name, cfg.Orbs[i].Name)
+				}
+				cfg.Orbs[i].Extensions = extensions
+			}
+		}
+
+		err = cfg.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// withoutExtension returns extension specifications without the ones for the named extension
+func withoutExtension(specs []string, name string) (result []string) {
+	result = make([]string, 0, len(specs))
+	for _, spec := range specs {
+		if orb.ParseExtension(spec).Name != name {
+			result = append(result, spec)
+		}
+	}
+	return
+}
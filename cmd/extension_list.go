@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var extensionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available and installed extensions",
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		orbs, err := extensionTargetOrbs(cluster)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		err = listExtensions(ctx, cluster, orbs)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func listExtensions(ctx context.Context, cluster orb.OrbCluster, orbs []string) (err error) {
+	var db *sql.DB
+	db, err = cluster.Connect(ctx, "omnigres")
+	if err != nil {
+		log.Error("Could not connect to orb. Ensure the docker container is running, perhaps 'omnigres start' will fix it.")
+		return
+	}
+	defer db.Close()
+
+	// Installed versions, by orb
+	installed := make(map[string]map[string]string)
+	for _, orbName := range orbs {
+		installed[orbName], err = installedExtensions(ctx, cluster, orbName)
+		if err != nil {
+			return
+		}
+	}
+
+	var rows *sql.Rows
+	rows, err = db.QueryContext(ctx, `select name, default_version from pg_available_extensions order by name`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	tableRows := make([][]string, 0)
+	for rows.Next() {
+		var name, defaultVersion string
+		err = rows.Scan(&name, &defaultVersion)
+		if err != nil {
+			return
+		}
+		row := []string{name, defaultVersion}
+		anyInstalled := false
+		for _, orbName := range orbs {
+			version := installed[orbName][name]
+			anyInstalled = anyInstalled || version != ""
+			row = append(row, version)
+		}
+		if extensionsInstalledOnly && !anyInstalled {
+			continue
+		}
+		tableRows = append(tableRows, row)
+	}
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99"))).
+		BorderColumn(false).
+		Headers(append([]string{"Extension", "Available"}, orbs...)...).
+		Rows(tableRows...)
+
+	fmt.Println(t)
+	return
+}
+
+// installedExtensions returns installed extension versions in the orb's
+// database, keyed by extension name. If the database doesn't exist yet, no
+// extensions are returned.
+func installedExtensions(ctx context.Context, cluster orb.OrbCluster, orbName string) (extensions map[string]string, err error) {
+	extensions = make(map[string]string)
+
+	var db *sql.DB
+	db, err = cluster.Connect(ctx, "omnigres")
+	if err != nil {
+		return
+	}
+	var dbExists bool
+	err = db.QueryRowContext(
+		ctx,
+		`select exists(select from pg_database where datname = $1)`,
+		orbName,
+	).Scan(&dbExists)
+	db.Close()
+	if err != nil || !dbExists {
+		return
+	}
+
+	var orbDb *sql.DB
+	orbDb, err = cluster.Connect(ctx, orbName)
+	if err != nil {
+		return
+	}
+	defer orbDb.Close()
+
+	var rows *sql.Rows
+	rows, err = orbDb.QueryContext(ctx, `select extname, extversion from pg_extension`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, version string
+		err = rows.Scan(&name, &version)
+		if err != nil {
+			return
+		}
+		extensions[name] = version
+	}
+	err = rows.Err()
+	return
+}
+
+var extensionsInstalledOnly bool
+
+func init() {
+	extensionListCmd.Flags().BoolVar(&extensionsInstalledOnly, "installed", false, "only list extensions installed in at least one orb")
+}
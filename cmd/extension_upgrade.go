@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/lib/pq"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var extensionUpgradeCmd = &cobra.Command{
+	Use:   "upgrade [extension...]",
+	Short: "Upgrade installed extensions",
+	Long: `Runs ALTER EXTENSION ... UPDATE in orb databases.
+
+Extensions pinned to a version in omnigres.yaml are updated to that version,
+others to the default version shipped with the image. By default, all
+installed extensions are upgraded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		orbs, err := extensionTargetOrbs(cluster)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		for _, orbName := range orbs {
+			err = upgradeExtensions(ctx, cluster, orbName, args)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func upgradeExtensions(ctx context.Context, cluster orb.OrbCluster, orbName string, names []string) (err error) {
+	var installed map[string]string
+	installed, err = installedExtensions(ctx, cluster, orbName)
+	if err != nil {
+		return
+	}
+	if len(installed) == 0 {
+		log.Warnf("Orb %s has no extensions installed, perhaps it needs to be assembled first", orbName)
+		return
+	}
+
+	pinned := make(map[string]string)
+	for _, ext := range requiredExtensions(cluster, orbName) {
+		pinned[ext.Name] = ext.Version
+	}
+
+	if len(names) == 0 {
+		for name := range installed {
+			names = append(names, name)
+		}
+	}
+
+	var db *sql.DB
+	db, err = cluster.Connect(ctx, orbName)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	for _, name := range names {
+		if _, ok := installed[name]; !ok {
+			log.Warnf("Extension %s is not installed in orb %s", name, orbName)
+			continue
+		}
+		statement := fmt.Sprintf(`alter extension %s update`, pq.QuoteIdentifier(name))
+		if version := pinned[name]; version != "" {
+			statement += fmt.Sprintf(` to %s`, pq.QuoteLiteral(version))
+		}
+		_, err = db.ExecContext(ctx, statement)
+		if err != nil {
+			err = fmt.Errorf("could not upgrade extension %s in orb %s: %w", name, orbName, err)
+			return
+		}
+
+		var version string
+		err = db.QueryRowContext(ctx, `select extversion from pg_extension where extname = $1`, name).Scan(&version)
+		if err != nil {
+			return
+		}
+		if version != installed[name] {
+			log.Infof("Upgraded extension %s in orb %s: %s → %s", name, orbName, installed[name], version)
+		} else {
+			log.Debugf("Extension %s in orb %s is up to date (%s)", name, orbName, version)
+		}
+	}
+	return
+}
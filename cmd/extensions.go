@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/lib/pq"
+	"github.com/omnigres/cli/orb"
+)
+
+// requiredExtensions returns the extensions listed for the orb in the configuration.
+// Orbs that are not configured (such as those coming from `run` sources) require none.
+func requiredExtensions(cluster orb.OrbCluster, orbName string) []orb.Extension {
+	cfg, ok := cluster.Config().Orb(orbName)
+	if !ok {
+		return nil
+	}
+	return cfg.RequiredExtensions()
+}
+
+// checkExtensionsAvailable fails early if the cluster's image doesn't ship
+// any of the extensions (or extension versions) required by the orbs
+func checkExtensionsAvailable(ctx context.Context, db *sql.DB, cluster orb.OrbCluster, orbs []string) (err error) {
+	missing := make([]string, 0)
+	for _, orbName := range orbs {
+		for _, ext := range requiredExtensions(cluster, orbName) {
+			var available bool
+			err = db.QueryRowContext(
+				ctx,
+				`select exists(select from pg_available_extension_versions where name = $1 and ($2 = '' or version = $2))`,
+				ext.Name, ext.Version,
+			).Scan(&available)
+			if err != nil {
+				return
+			}
+			if !available {
+				missing = append(missing, fmt.Sprintf("%s (orb %s)", ext, orbName))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		err = fmt.Errorf("image %s does not provide required extensions: %s",
+			cluster.Config().Image.Name, strings.Join(missing, ", "))
+	}
+	return
+}
+
+// installExtensions creates the orb's required extensions in the database,
+// updating pinned extensions that are already installed at a different version
+func installExtensions(ctx context.Context, cluster orb.OrbCluster, orbName string, dbName string) (err error) {
+	extensions := requiredExtensions(cluster, orbName)
+	if len(extensions) == 0 {
+		return
+	}
+
+	var db *sql.DB
+	db, err = cluster.Connect(ctx, dbName)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	for _, ext := range extensions {
+		log.Debug("Installing extension", "extension", ext, "database", dbName)
+		statement := fmt.Sprintf(`create extension if not exists %s`, pq.QuoteIdentifier(ext.Name))
+		if ext.Version != "" {
+			statement += fmt.Sprintf(` version %s`, pq.QuoteLiteral(ext.Version))
+		}
+		_, err = db.ExecContext(ctx, statement+` cascade`)
+		if err != nil {
+			err = fmt.Errorf("could not install extension %s: %w", ext, err)
+			return
+		}
+
+		if ext.Version == "" {
+			continue
+		}
+		var installed string
+		err = db.QueryRowContext(ctx, `select extversion from pg_extension where extname = $1`, ext.Name).Scan(&installed)
+		if err != nil {
+			return
+		}
+		if installed != ext.Version {
+			log.Infof("Updating extension %s from %s to %s", ext.Name, installed, ext.Version)
+			_, err = db.ExecContext(ctx, fmt.Sprintf(`alter extension %s update to %s`,
+				pq.QuoteIdentifier(ext.Name), pq.QuoteLiteral(ext.Version)))
+			if err != nil {
+				err = fmt.Errorf("could not update extension %s: %w", ext, err)
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Omnigres image management",
+}
+
+func init() {
+	rootCmd.AddCommand(imageCmd)
+	imageCmd.AddCommand(imagePullCmd)
+	imageCmd.AddCommand(imageListCmd)
+	imageCmd.AddCommand(imagePinCmd)
+	imageCmd.AddCommand(imageUpgradeCmd)
+	imageCmd.AddCommand(imagePruneCmd)
+	imageCmd.AddCommand(imageBuildCmd)
+}
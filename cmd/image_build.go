@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var imageBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build the workspace's custom image",
+	Long: `Builds the custom image described in omnigres.yaml:
+
+  image:
+    build:
+      base: ghcr.io/omnigres/omnigres-17:latest
+      packages: [postgresql-17-postgis-3]
+      extensions: [extensions/my_ext]
+
+Instead of packages and extensions, a Dockerfile (relative to the
+workspace) can be given; the base image is passed to it as the
+BASE_IMAGE build argument. Its directory is the build context, filtered
+by .dockerignore; omnigres.yaml, omnigres.run.yaml, backups and .env
+files are always left out.
+
+The image is tagged omnigres-<workspace>:<hash of the inputs> and is
+only rebuilt when the inputs change, unless --force is given. The base
+image (pulled if it's not available locally) is one of the inputs, so a
+newer version of it triggers a rebuild.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var tag string
+		tag, err = cluster.BuildImage(context.Background(), forceBuild)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = cluster.Config().Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Built %s", tag)
+	},
+}
+
+var forceBuild bool
+
+func init() {
+	imageBuildCmd.Flags().BoolVar(&forceBuild, "force", false, "rebuild even if the inputs have not changed")
+}
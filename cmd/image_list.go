@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var imageListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List local Omnigres images",
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		var images []orb.ImageInfo
+		images, err = cluster.Images(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		pinned := cluster.Config().Image.Digest
+		rows := make([][]string, 0, len(images))
+		for _, img := range images {
+			marker := ""
+			for _, digest := range img.Digests {
+				if digest == pinned {
+					marker = "*"
+				}
+			}
+			rows = append(rows, []string{
+				marker,
+				strings.Join(img.Tags, "\n"),
+				strings.Join(img.Digests, "\n"),
+				img.Created.Format("2006-01-02 15:04"),
+				fmt.Sprintf("%.1f MB", float64(img.Size)/1e6),
+				fmt.Sprintf("%d", img.Containers),
+			})
+		}
+
+		t := table.New().
+			Border(lipgloss.RoundedBorder()).
+			BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99"))).
+			BorderColumn(false).
+			BorderRow(true).
+			Headers("", "Tags", "Digests", "Created", "Size", "Containers").
+			Rows(rows...)
+
+		fmt.Println(t)
+		if pinned != "" {
+			fmt.Println("* pinned in omnigres.yaml")
+		}
+	},
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var imagePinCmd = &cobra.Command{
+	Use:   "pin [digest]",
+	Short: "Pin the image digest in omnigres.yaml",
+	Long: `Pins the workspace to a specific image digest.
+
+The digest can be given as sha256:..., or as a full reference
+(image@sha256:...), in which case the image name is updated as well.
+Without arguments, the digest of the locally available image is pinned.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg := cluster.Config()
+		var digest string
+		switch {
+		case len(args) == 0:
+			digest, err = cluster.ImageDigest(context.Background(), cfg.Image.Name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if digest == "" {
+				log.Fatalf("Image %s has no digest", cfg.Image.Name)
+			}
+		case strings.HasPrefix(args[0], "sha256:"):
+			digest = fmt.Sprintf("%s@%s", orb.ImageRepository(cfg.Image.Name), args[0])
+		case strings.Contains(args[0], "@sha256:"):
+			digest = args[0]
+			if name := orb.ImageRepository(digest); name != orb.ImageRepository(cfg.Image.Name) {
+				cfg.Image.Name = name
+				cfg.FollowImage(name)
+			}
+		default:
+			log.Fatalf("%s is not a digest", args[0])
+		}
+
+		cfg.Image.Digest = digest
+		err = cfg.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Pinned %s", digest)
+	},
+}
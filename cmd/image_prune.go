@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var imagePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove unused Omnigres images",
+	Long: `Removes local images built for this workspace that are not used by
+any container and are not the image configured in omnigres.yaml.
+
+With --all, unused Omnigres images of other workspaces and pulled images
+are removed, too. Images are listed for confirmation before removal.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		var images []orb.ImageInfo
+		images, err = cluster.Images(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg := cluster.Config()
+		configuredTag := cfg.Image.Name
+		if orb.ImageRepository(configuredTag) == configuredTag {
+			configuredTag += ":latest"
+		}
+		unused := lo.Filter(images, func(img orb.ImageInfo, _ int) bool {
+			return (img.Workspace || imagePruneAll) &&
+				img.Containers == 0 &&
+				!lo.Contains(img.Digests, cfg.Image.Digest) &&
+				!lo.Contains(img.Tags, configuredTag)
+		})
+		if len(unused) == 0 {
+			log.Info("No unused images")
+			return
+		}
+
+		fmt.Println("The following images will be removed:")
+		for _, img := range unused {
+			fmt.Printf("  - %s\n", strings.Join(append(img.Tags, img.Digests...), ", "))
+		}
+		var ok bool
+		ok, err = confirm(fmt.Sprintf("Remove %d image(s)?", len(unused)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			return
+		}
+
+		for _, img := range unused {
+			err = cluster.RemoveImage(ctx, img.ID)
+			if err != nil {
+				log.Error("Could not remove image", "id", img.ID, "err", err)
+			}
+		}
+	},
+}
+
+var imagePruneAll bool
+
+func init() {
+	imagePruneCmd.Flags().BoolVar(&imagePruneAll, "all", false, "remove all unused Omnigres images, not only those built for this workspace")
+}
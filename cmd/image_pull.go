@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var imagePullCmd = &cobra.Command{
+	Use:   "pull [image]",
+	Short: "Pull an Omnigres image",
+	Long: `Pulls the given image or, by default, the one configured in omnigres.yaml
+(using the pinned digest, if any).`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		imageName := cluster.Config().Image.Name
+		if cluster.Config().Image.Digest != "" {
+			imageName = cluster.Config().Image.Digest
+		}
+		if len(args) > 0 {
+			imageName = args[0]
+		}
+
+		ctx := context.Background()
+		var digest string
+		digest, err = cluster.PullImage(ctx, imageName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(digest)
+	},
+}
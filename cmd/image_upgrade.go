@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var imageUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade to the newest image",
+	Long: `Pulls the newest version of the configured image tag and pins its
+digest in omnigres.yaml. For a custom image, the newest version of its
+base image is pulled and the custom image is rebuilt on top of it.
+
+With --recreate, the cluster's container is recreated using the new image.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		cfg := cluster.Config()
+		var upgraded bool
+		if cfg.Image.Build != nil {
+			upgraded, err = upgradeBaseImage(ctx, cluster)
+		} else {
+			upgraded, err = pullNewestImage(ctx, cluster)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !upgraded {
+			return
+		}
+
+		err = cfg.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if imageUpgradeRecreate {
+			err = recreateCluster(ctx, cluster)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+// pullNewestImage pulls the configured image tag and pins its new digest
+func pullNewestImage(ctx context.Context, cluster orb.OrbCluster) (upgraded bool, err error) {
+	cfg := cluster.Config()
+	oldDigest := cfg.Image.Digest
+	if oldDigest == "" {
+		oldDigest, _ = cluster.ImageDigest(ctx, cfg.Image.Name)
+	}
+
+	var newDigest string
+	newDigest, err = cluster.PullImage(ctx, cfg.Image.Name)
+	if err != nil {
+		return
+	}
+
+	if newDigest == oldDigest {
+		log.Infof("Image %s is up to date", cfg.Image.Name)
+		return
+	}
+	log.Info("Upgraded image", "image", cfg.Image.Name, "old", oldDigest, "new", newDigest)
+	cfg.Image.Digest = newDigest
+	upgraded = true
+	return
+}
+
+// upgradeBaseImage pulls the base of the custom image and rebuilds the
+// custom image on top of it
+func upgradeBaseImage(ctx context.Context, cluster orb.OrbCluster) (upgraded bool, err error) {
+	cfg := cluster.Config()
+	base := cfg.Image.Build.Base
+	if base == "" {
+		base = cfg.Image.Name
+	}
+	oldDigest, _ := cluster.ImageDigest(ctx, base)
+
+	var newDigest string
+	newDigest, err = cluster.PullImage(ctx, base)
+	if err != nil {
+		return
+	}
+
+	if newDigest == oldDigest {
+		log.Infof("Base image %s is up to date", base)
+		return
+	}
+	log.Info("Upgraded base image", "image", base, "old", oldDigest, "new", newDigest)
+
+	var tag string
+	tag, err = cluster.BuildImage(ctx, true)
+	if err != nil {
+		return
+	}
+	log.Infof("Built %s", tag)
+	upgraded = true
+	return
+}
+
+// recreateCluster replaces the cluster's container with a new one
+func recreateCluster(ctx context.Context, cluster orb.OrbCluster) (err error) {
+	var ok bool
+	ok, err = confirm(recreateQuestion(cluster))
+	if err != nil {
+		return
+	}
+	if !ok {
+		return
+	}
+
+	// Give Postgres a chance to shut down cleanly
+	_ = cluster.Stop(ctx)
+	err = cluster.Remove(ctx)
+	if err != nil {
+		log.Warn("Could not remove the container", "err", err)
+	}
+	return startCluster(ctx, cluster)
+}
+
+var imageUpgradeRecreate bool
+
+func init() {
+	imageUpgradeCmd.Flags().BoolVar(&imageUpgradeRecreate, "recreate", false, "recreate the cluster's container with the new image")
+}
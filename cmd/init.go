@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/charmbracelet/log"
-	"github.com/omnigres/cli/internal/fileutils"
 	"github.com/omnigres/cli/orb"
+	"github.com/omnigres/cli/src"
+	"github.com/omnigres/cli/templates"
 	"github.com/spf13/cobra"
-	"path/filepath"
 )
 
 // initCmd represents the init command
@@ -32,6 +38,7 @@ design and use one or more Omnigres extension.`,
 		}
 
 		cfg := orb.NewConfig()
+		cfg.ID = orb.NewWorkspaceID()
 		cfg.Orbs = append(cfg.Orbs, orb.OrbCfg{
 			Name: orbName,
 		})
@@ -39,8 +46,22 @@ design and use one or more Omnigres extension.`,
 		if err != nil {
 			log.Fatal(err)
 		}
-		for _, dir := range []string{"src", "migrations"} {
-			err = fileutils.CreateIfNotExists(filepath.Join(path, orbName, dir), true)
+		err = scaffoldOrb(filepath.Join(path, orbName))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if initTemplate != "" {
+			var tmplCfg templates.Config
+			tmplCfg, err = renderTemplate(initTemplate, filepath.Join(path, orbName), templates.Vars{
+				Orb:       orbName,
+				Workspace: filepath.Base(path),
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+			applyTemplateConfig(cfg, orbName, tmplCfg)
+			err = cfg.SaveAs(path)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -49,6 +70,64 @@ design and use one or more Omnigres extension.`,
 	Args: cobra.MaximumNArgs(1),
 }
 
+// renderTemplate renders a built-in template, or one from any source
+// supported by `src.GetSourceDirectory`, into the orb directory and returns
+// what the template asks of the configuration
+func renderTemplate(name string, orbDir string, vars templates.Vars) (tmplCfg templates.Config, err error) {
+	var fsys fs.FS
+	if templates.IsBuiltin(name) {
+		fsys, err = templates.BuiltinFS(name)
+		if err != nil {
+			return
+		}
+	} else {
+		var srcdir src.SourceDirectory
+		srcdir, err = src.GetSourceDirectory(name)
+		if err != nil {
+			err = fmt.Errorf("%w\nBuilt-in templates: %s", err, strings.Join(templates.Builtin(), ", "))
+			return
+		}
+		defer srcdir.Close()
+		if named, ok := srcdir.(src.NamedSourceDirectory); ok {
+			fsys = os.DirFS(filepath.Join(named.Path(), named.Name()))
+		} else {
+			fsys = os.DirFS(srcdir.Path())
+		}
+	}
+	log.Debug("Rendering template", "template", name, "orb", vars.Orb)
+	tmplCfg, err = templates.LoadConfig(fsys, vars)
+	if err != nil {
+		return
+	}
+	err = templates.Render(fsys, orbDir, vars)
+	return
+}
+
+// applyTemplateConfig adds the template's extensions to the orb and its
+// Postgres parameters to the workspace
+func applyTemplateConfig(cfg *orb.Config, orbName string, tmplCfg templates.Config) {
+	for i := range cfg.Orbs {
+		if cfg.Orbs[i].Name != orbName {
+			continue
+		}
+		for _, spec := range tmplCfg.Extensions {
+			ext := orb.ParseExtension(spec)
+			cfg.Orbs[i].Extensions = append(withoutExtension(cfg.Orbs[i].Extensions, ext.Name), ext.String())
+		}
+	}
+	if len(tmplCfg.Postgres) > 0 && cfg.Postgres == nil {
+		cfg.Postgres = make(map[string]string)
+	}
+	for name, value := range tmplCfg.Postgres {
+		cfg.Postgres[name] = value
+	}
+}
+
+var initTemplate string
+
 func init() {
 	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVarP(&initTemplate, "template", "t", "",
+		fmt.Sprintf("template to initialize the orb from: a built-in one (%s), a directory, a gist URL, a git repository (git+<url>#ref:subdir) or a .tar.gz, .tgz or .zip archive",
+			strings.Join(templates.Builtin(), ", ")))
 }
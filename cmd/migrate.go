@@ -8,6 +8,7 @@ import (
 	"github.com/omnigres/cli/orb"
 	"github.com/spf13/cobra"
 	"os"
+	"strings"
 )
 
 var migrateCmd = &cobra.Command{
@@ -34,11 +35,14 @@ var migrateCmd = &cobra.Command{
 
 		ctx := context.Background()
 		log.Debug("Migrate revisions in orbs", "orbs", orbs)
-		migrateRevisions(
+		err = migrateRevisions(
 			ctx,
 			cluster,
 			orbs,
 		)
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -53,60 +57,92 @@ func migrateRevisions(
 		log.Error("Could not connect to orb. Ensure the docker container is running, perhaps 'omnigres start' will fix it.")
 		return
 	}
+	defer db.Close()
+	err = checkExtensionsAvailable(ctx, db, cluster, orbs)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var failed []string
 	for _, orbName := range orbs {
 		log.Infof("Migrating orb %s", orbName)
-		conn, err := db.Conn(ctx)
+		var orbFailed []string
+		orbFailed, err = migrateOrb(ctx, cluster, db, orbName)
 		if err != nil {
 			log.Error(err)
-			return err
+			return
 		}
-		err = setupCloudevents(ctx, conn)
-		if err != nil {
-			log.Error(err)
-			return err
-		}
-		defer conn.Close()
+		failed = append(failed, orbFailed...)
+	}
 
-		var dbExists bool
-		err = db.QueryRowContext(
-			ctx,
-			`select exists(select from pg_database where datname = $1)`,
-			orbName,
-		).Scan(&dbExists)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to apply revisions %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// migrateOrb applies the orb's revisions to its database, creating it if
+// needed, and returns the revisions that failed to apply
+func migrateOrb(ctx context.Context, cluster orb.OrbCluster, db *sql.DB, orbName string) (failed []string, err error) {
+	var conn *sql.Conn
+	conn, err = db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	err = setupCloudevents(ctx, conn)
+	if err != nil {
+		return
+	}
+
+	var dbExists bool
+	err = db.QueryRowContext(
+		ctx,
+		`select exists(select from pg_database where datname = $1)`,
+		orbName,
+	).Scan(&dbExists)
+	if err != nil {
+		return
+	}
+
+	if !dbExists {
+		_, err = db.ExecContext(ctx, fmt.Sprintf(`create database %q`, orbName))
 		if err != nil {
-			log.Fatal(err)
+			return
 		}
+	}
 
-		if !dbExists {
-			_, err = db.ExecContext(ctx, fmt.Sprintf(`create database %q`, orbName))
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
+	err = installExtensions(ctx, cluster, orbName, orbName)
+	if err != nil {
+		return
+	}
 
-		var rows *sql.Rows
-		rows, err = conn.QueryContext(
-			ctx,
-			`select revision, omni_schema.migrate_to_schema_revision(omni_vfs.local_fs($1), 'revisions', revision, $2) is null as success
+	var rows *sql.Rows
+	rows, err = conn.QueryContext(
+		ctx,
+		`select revision, omni_schema.migrate_to_schema_revision(omni_vfs.local_fs($1), 'revisions', revision, $2) is null as success
 from omni_schema.schema_revisions(omni_vfs.local_fs($1), 'revisions')`,
-			fmt.Sprintf("/mnt/host/%s", orbName),
-			fmt.Sprintf("dbname=%s user=omnigres", orbName),
-		)
-		if err != nil {
-			log.Error(err)
-			return err
-		}
+		cluster.OrbPath(orbName),
+		fmt.Sprintf("dbname=%s user=omnigres", orbName),
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
 		var revision string
 		var success bool
-		for rows.Next() {
-			err = rows.Scan(&revision, &success)
-			if success {
-				log.Infof("✅ Applied revision %s", revision)
-			} else {
-				log.Infof("🔴 Failed to apply revision %s", revision)
-			}
+		err = rows.Scan(&revision, &success)
+		if err != nil {
+			return
+		}
+		if success {
+			log.Infof("✅ Applied revision %s", revision)
+		} else {
+			log.Infof("🔴 Failed to apply revision %s", revision)
+			failed = append(failed, fmt.Sprintf("%s/%s", orbName, revision))
 		}
 	}
-
-	return nil
+	err = rows.Err()
+	return
 }
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/omnigres/cli/internal/fileutils"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var orbCmd = &cobra.Command{
+	Use:   "orb",
+	Short: "Orb management",
+}
+
+// loadWorkspaceConfig loads the workspace configuration without setting up a cluster
+func loadWorkspaceConfig() (path string, cfg *orb.Config, err error) {
+	path, err = getOrbPath(false)
+	if err != nil {
+		return
+	}
+	cfg, err = orb.LoadConfig(path)
+	return
+}
+
+// validateOrbName ensures the name can be used both as a directory and a database name
+func validateOrbName(name string) (err error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || !filepath.IsLocal(name) {
+		err = fmt.Errorf("invalid orb name %q", name)
+	}
+	return
+}
+
+// scaffoldOrb creates the directory structure of an orb in its directory
+func scaffoldOrb(orbDir string) (err error) {
+	for _, dir := range []string{"src", "migrations"} {
+		err = fileutils.CreateIfNotExists(filepath.Join(orbDir, dir), true)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func init() {
+	rootCmd.AddCommand(orbCmd)
+	orbCmd.AddCommand(orbAddCmd)
+	orbCmd.AddCommand(orbRemoveCmd)
+	orbCmd.AddCommand(orbRenameCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var orbAddCmd = &cobra.Command{
+	Use:   "add name...",
+	Short: "Add orbs to the workspace",
+	Long: `Adds orbs to omnigres.yaml and creates their directories.
+
+By default, orbs live in the workspace directory. With --path, an orb can
+live anywhere on disk, for example in a sibling repository.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, cfg, err := loadWorkspaceConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if orbAddPath != "" && len(args) > 1 {
+			log.Fatal("--path can only be used when adding a single orb")
+		}
+
+		for _, orbName := range args {
+			err = validateOrbName(orbName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, ok := cfg.Orb(orbName); ok {
+				log.Fatalf("Orb %s already exists", orbName)
+			}
+			orbCfg := orb.OrbCfg{Name: orbName, Path: orbAddPath}
+			cfg.Orbs = append(cfg.Orbs, orbCfg)
+			err = scaffoldOrb(orbCfg.HostPath(path))
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Infof("Added orb %s", orbName)
+		}
+
+		err = cfg.SaveAs(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var orbAddPath string
+
+func init() {
+	orbAddCmd.Flags().StringVar(&orbAddPath, "path", "", "orb directory, absolute or relative to the workspace")
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var orbRemoveCmd = &cobra.Command{
+	Use:   "remove name...",
+	Short: "Remove orbs from the workspace",
+	Long: `Removes orbs from omnigres.yaml.
+
+Orb directories are kept unless --delete-files is given (directories of
+orbs with their own path are always kept). Orb databases are never dropped.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, cfg, err := loadWorkspaceConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		removed := make([]orb.OrbCfg, 0, len(args))
+		for _, orbName := range args {
+			orbCfg, ok := cfg.Orb(orbName)
+			if !ok {
+				log.Fatalf("Orb %s is not configured in this workspace", orbName)
+			}
+			removed = append(removed, orbCfg)
+		}
+
+		if orbDeleteFiles {
+			var ok bool
+			ok, err = confirm(fmt.Sprintf("Delete directories of %d orb(s)?", len(args)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !ok {
+				log.Fatal("Aborted")
+			}
+		}
+
+		cfg.Orbs = lo.Filter(cfg.Orbs, func(o orb.OrbCfg, _ int) bool { return !lo.Contains(args, o.Name) })
+		err = cfg.SaveAs(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, orbCfg := range removed {
+			if orbDeleteFiles {
+				if orbCfg.Path != "" {
+					log.Warnf("Orb %s lives outside of the workspace, leaving %s in place", orbCfg.Name, orbCfg.HostPath(path))
+				} else {
+					err = os.RemoveAll(orbCfg.HostPath(path))
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+			}
+			log.Infof("Removed orb %s", orbCfg.Name)
+		}
+	},
+}
+
+var orbDeleteFiles bool
+
+func init() {
+	orbRemoveCmd.Flags().BoolVar(&orbDeleteFiles, "delete-files", false, "also delete orb directories")
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+	"github.com/lib/pq"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var orbRenameCmd = &cobra.Command{
+	Use:   "rename old new",
+	Short: "Rename an orb",
+	Long: `Renames an orb, moving its directory and updating omnigres.yaml.
+
+With --database, the orb's database in the running cluster is renamed, too.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		oldName, newName := args[0], args[1]
+
+		path, cfg, err := loadWorkspaceConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = validateOrbName(newName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		orbCfg, ok := cfg.Orb(oldName)
+		if !ok {
+			log.Fatalf("Orb %s is not configured in this workspace", oldName)
+		}
+		if _, ok := cfg.Orb(newName); ok {
+			log.Fatalf("Orb %s already exists", newName)
+		}
+
+		// Orbs with their own path keep their directory
+		moveDirectory := orbCfg.Path == ""
+		oldPath, newPath := filepath.Join(path, oldName), filepath.Join(path, newName)
+		if moveDirectory {
+			if _, err = os.Stat(oldPath); err != nil {
+				log.Fatalf("Orb directory %s is not accessible: %v", oldPath, err)
+			}
+			if _, err = os.Stat(newPath); err == nil {
+				log.Fatalf("Directory %s already exists", newPath)
+			}
+		}
+
+		var cluster orb.OrbCluster
+		if orbRenameDatabase {
+			cluster, err = getOrbCluster()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Steps are taken in the order they are easiest to undo, and undone
+		// in reverse if a later one fails
+		var undo []func() error
+		fail := func(err error) {
+			for i := len(undo) - 1; i >= 0; i-- {
+				if undoErr := undo[i](); undoErr != nil {
+					log.Error("Could not undo the rename", "err", undoErr)
+				}
+			}
+			log.Fatal(err)
+		}
+
+		if moveDirectory {
+			err = os.Rename(oldPath, newPath)
+			if err != nil {
+				fail(err)
+			}
+			undo = append(undo, func() error { return os.Rename(newPath, oldPath) })
+		}
+
+		setName := func(from string, to string) error {
+			for i := range cfg.Orbs {
+				if cfg.Orbs[i].Name == from {
+					cfg.Orbs[i].Name = to
+				}
+			}
+			return cfg.SaveAs(path)
+		}
+		err = setName(oldName, newName)
+		if err != nil {
+			fail(err)
+		}
+		undo = append(undo, func() error { return setName(newName, oldName) })
+
+		if orbRenameDatabase {
+			err = renameOrbDatabase(context.Background(), cluster, oldName, newName)
+			if err != nil {
+				fail(err)
+			}
+		}
+		log.Infof("Renamed orb %s to %s", oldName, newName)
+	},
+}
+
+func renameOrbDatabase(ctx context.Context, cluster orb.OrbCluster, oldName string, newName string) (err error) {
+	var db *sql.DB
+	db, err = cluster.Connect(ctx, "omnigres")
+	if err != nil {
+		log.Error("Could not connect to orb. Ensure the docker container is running, perhaps 'omnigres start' will fix it.")
+		return
+	}
+	defer db.Close()
+
+	var dbExists bool
+	err = db.QueryRowContext(
+		ctx,
+		`select exists(select from pg_database where datname = $1)`,
+		oldName,
+	).Scan(&dbExists)
+	if err != nil {
+		return
+	}
+	if !dbExists {
+		log.Warnf("Orb %s has no database to rename", oldName)
+		return
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`alter database %s rename to %s`, pq.QuoteIdentifier(oldName), pq.QuoteIdentifier(newName)))
+	if err != nil {
+		err = fmt.Errorf("could not rename database %s: %w", oldName, err)
+	}
+	return
+}
+
+var orbRenameDatabase bool
+
+func init() {
+	orbRenameCmd.Flags().BoolVar(&orbRenameDatabase, "database", false, "also rename the orb's database in the running cluster")
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/omnigres/cli/internal/fileutils"
 	"github.com/omnigres/cli/orb"
+	"github.com/omnigres/cli/tui"
 	"os"
 	"path/filepath"
 )
@@ -43,7 +44,11 @@ func getOrbCluster() (cluster orb.OrbCluster, err error) {
 	if err != nil {
 		return
 	}
-	err = cluster.Configure(orb.OrbOptions{Config: cfg, Path: orbPath})
+	err = cluster.Configure(orb.OrbOptions{
+		Config:   cfg,
+		Path:     orbPath,
+		Progress: tui.ProgressOptions{NoTUI: noTUI, JSON: jsonProgress, Layers: layerProgress},
+	})
 	if err != nil {
 		return
 	}
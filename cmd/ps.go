@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var psCmd = &cobra.Command{
+	Use:   "ps",
+	Short: "List Omnigres clusters on this host",
+	Long: `Lists the clusters of all workspaces, including the ones started by
+'omnigres run' and 'omnigres test --matrix'.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster, err := orb.NewDockerOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cluster.Close()
+
+		var clusters []orb.ClusterInfo
+		clusters, err = cluster.Clusters(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		rows := make([][]string, 0, len(clusters))
+		for _, info := range clusters {
+			endpoints := make([]string, 0, len(info.Endpoints))
+			for _, endpoint := range info.Endpoints {
+				endpoints = append(endpoints, endpoint.String())
+			}
+			name := info.Name
+			if info.Ephemeral {
+				name += " (ephemeral)"
+			}
+			rows = append(rows, []string{
+				name,
+				info.Workspace,
+				info.Status,
+				info.Image,
+				strings.Join(endpoints, "\n"),
+			})
+		}
+
+		t := table.New().
+			Border(lipgloss.RoundedBorder()).
+			BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99"))).
+			BorderColumn(false).
+			BorderRow(true).
+			Headers("Name", "Workspace", "Status", "Image", "Endpoints").
+			Rows(rows...)
+
+		fmt.Println(t)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(psCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Apply resources and Postgres settings to the running cluster",
+	Long: `Applies the resources and postgres sections of omnigres.yaml to the
+running cluster:
+
+  resources:
+    memory: 2g
+    cpus: 1.5
+    shm_size: 256m
+  postgres:
+    max_connections: "200"
+    log_statement: all
+
+Memory and CPU limits are updated in place, a changed shm_size only applies
+to a new container.
+
+Postgres parameters are passed to Postgres on the command line when the
+container is created, so that even those requiring a restart are in effect
+from the start. Parameters added since are set with ALTER SYSTEM and the
+configuration is reloaded; if any of them requires it, the cluster is
+restarted. Parameters changed since the container was created take effect
+once it is recreated ('omnigres restart --recreate').`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = cluster.Reload(context.Background(), waitTimeout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Cluster reloaded")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reloadCmd)
+	reloadCmd.Flags().DurationVar(&waitTimeout, "wait-timeout", orb.DefaultWaitTimeout, "how long to wait for the cluster to become ready if it is restarted")
+}
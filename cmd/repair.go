@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Restore the runfile from the cluster's container",
+	Long: `Finds the workspace's container by its labels and rewrites
+omnigres.run.yaml to point to it.
+
+Use it when the runfile was deleted, or when the workspace was moved or
+cloned again, so that the existing container is used instead of a new one.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var id string
+		id, err = cluster.Repair(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Runfile points to the cluster's container", "container", id)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+)
+
+var errResetAborted = errors.New("reset aborted")
+
+// guardDatabaseReset is consulted before dropping orb databases.
+//
+// It refuses to touch protected orbs, lists the existing databases that are
+// about to be dropped and asks for confirmation. If requested, every such
+// database is dumped into the workspace before returning.
+func guardDatabaseReset(
+	ctx context.Context,
+	cluster orb.OrbCluster,
+	orbs []string,
+	databaseForOrb func(string) string,
+	backup bool,
+) (err error) {
+	for _, orbName := range orbs {
+		if cfg, ok := cluster.Config().Orb(orbName); ok && cfg.Protected {
+			err = fmt.Errorf("orb %s is protected, refusing to reset its database", orbName)
+			return
+		}
+	}
+
+	var db *sql.DB
+	db, err = cluster.Connect(ctx, "omnigres")
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	databases := make([]string, 0, len(orbs))
+	for _, orbName := range orbs {
+		dbName := databaseForOrb(orbName)
+		var dbExists bool
+		err = db.QueryRowContext(
+			ctx,
+			`select exists(select from pg_database where datname = $1)`,
+			dbName,
+		).Scan(&dbExists)
+		if err != nil {
+			return
+		}
+		if dbExists {
+			databases = append(databases, dbName)
+		}
+	}
+
+	if len(databases) == 0 {
+		return
+	}
+
+	fmt.Println("The following databases will be dropped:")
+	for _, dbName := range databases {
+		fmt.Printf("  - %s\n", dbName)
+	}
+	var ok bool
+	ok, err = confirm(fmt.Sprintf("Drop %d database(s)?", len(databases)))
+	if err != nil {
+		return
+	}
+	if !ok {
+		err = errResetAborted
+		return
+	}
+
+	if backup {
+		for _, dbName := range databases {
+			_, err = backupDatabase(ctx, cluster, dbName)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// backupDatabase dumps the database into the `backups` directory of the workspace
+func backupDatabase(ctx context.Context, cluster orb.OrbCluster, dbName string) (filename string, err error) {
+	var path string
+	path, err = getOrbPath(false)
+	if err != nil {
+		return
+	}
+	dir := filepath.Join(path, "backups")
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return
+	}
+
+	filename = filepath.Join(dir, fmt.Sprintf("%s-%s.sql", dbName, time.Now().Format("20060102150405")))
+	var file *os.File
+	file, err = os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	log.Infof("Backing up %s to %s", dbName, filename)
+	err = cluster.Dump(ctx, dbName, file)
+	if err != nil {
+		err = fmt.Errorf("could not back up %s: %w", dbName, err)
+	}
+	return
+}
+
+// ensureDisposableDatabase fails if the database belongs to a configured orb.
+//
+// Commands that drop their own scratch databases call it first so that a
+// naming mistake never takes an orb's database with it.
+func ensureDisposableDatabase(cluster orb.OrbCluster, dbName string) (err error) {
+	if _, ok := cluster.Config().Orb(dbName); ok {
+		err = fmt.Errorf("refusing to drop database %s as it belongs to an orb", dbName)
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+	"github.com/omnigres/cli/orb"
+	"github.com/spf13/cobra"
+)
+
+var restartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart cluster",
+	Long: `Stops the cluster and starts it again.
+
+If the container does not match the configuration (image, environment,
+mounts, shared memory size or Postgres parameters), the differences are
+shown and recreating the container is offered. With --recreate, the
+container is recreated regardless. Data survives recreation only if a
+volume is configured in omnigres.yaml (volume: <name>).`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		if restartRecreate {
+			err = recreateCluster(ctx, cluster)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		err = cluster.Stop(ctx)
+		if err != nil {
+			log.Warn("Could not stop the cluster", "err", err)
+		}
+		err = startCluster(ctx, cluster)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var restartRecreate bool
+
+func init() {
+	rootCmd.AddCommand(restartCmd)
+	addWaitFlags(restartCmd)
+	restartCmd.Flags().BoolVar(&restartRecreate, "recreate", false, "recreate the container")
+}
@@ -72,7 +72,7 @@ func listRevisions(
 		rows, err = conn.QueryContext(
 			ctx,
 			`select revision from omni_schema.schema_revisions(omni_vfs.local_fs($1), 'revisions')`,
-			fmt.Sprintf("/mnt/host/%s", orbName),
+			cluster.OrbPath(orbName),
 		)
 		if err != nil {
 			log.Error(err)
@@ -30,6 +30,10 @@ func Execute() {
 
 var workspace string
 var verbose bool
+var assumeYes bool
+var noTUI bool
+var jsonProgress bool
+var layerProgress bool
 
 func findOmnigresDir(dir string) (string, error) {
 	if _, err := os.Stat(filepath.Join(dir, "omnigres.yaml")); err == nil {
@@ -56,4 +60,8 @@ func init() {
 	}
 	rootCmd.PersistentFlags().StringVarP(&workspace, "workspace", "w", omnigresDir, "path to workspace")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "display debug messages")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "answer yes to all confirmation prompts")
+	rootCmd.PersistentFlags().BoolVar(&noTUI, "no-tui", false, "report progress as plain text (default when stdout is not a terminal)")
+	rootCmd.PersistentFlags().BoolVar(&jsonProgress, "progress-json", false, "report progress as JSON events, one per line")
+	rootCmd.PersistentFlags().BoolVar(&layerProgress, "progress-layers", false, "report progress of every image layer")
 }
@@ -9,22 +9,39 @@ import (
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/omnigres/cli/orb"
 	"github.com/omnigres/cli/src"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var runCmd = &cobra.Command{
-	Use:   "run [orb]",
+	Use:   "run [[name=]source...]",
 	Short: "Run a one-off cluster",
 	Long: `Run an Omnigres cluster in foreground.
 
     It's going to operate until it shut down. No run file will be created.
+
+    The source can be a directory, a GitHub gist URL, a git repository
+    (git+https://host/repo.git#ref:subdir or file:///path/to/repo#ref:subdir)
+    or a .tar.gz, .tgz or .zip archive (local or HTTP(S) URL).
+
+    Multiple sources can be given, each is assembled into its own database,
+    named after the orb or explicitly: omnigres run a=./one b=./two
    `,
 	Run: func(cmd *cobra.Command, args []string) {
+		if listSources {
+			for _, resolver := range src.Resolvers() {
+				fmt.Printf("%3d  %s\n", resolver.Priority(), resolver.Scheme())
+			}
+			return
+		}
+
 		var err error
 		var orbs []string
+
 		if len(args) == 0 {
 			var path string
 			path, err = getOrbPath(false)
@@ -32,34 +49,36 @@ var runCmd = &cobra.Command{
 			orbs = []string{filepath.Base(path)}
 		}
 
-		if len(args) == 1 {
-			inputPath := args[0]
-			srcdir, err := src.GetSourceDirectory(inputPath)
-			if err != nil {
-				log.Fatal(err)
-			}
-			defer srcdir.Close()
-
-			if src.IsGitHubGistURL(inputPath) {
-				orbs = []string{"gist"}
-			} else {
-				workspace = srcdir.Path()
-				var path string
-				path, err = getOrbPath(false)
-
-				orbs = []string{filepath.Base(path)}
-			}
-
+		var sources []runSource
+		sources, err = resolveRunSources(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// log.Fatal doesn't run deferred functions, sources are closed before it's called
+		defer closeRunSources(sources)
+		for _, source := range sources {
+			orbs = append(orbs, source.orb.Name)
 		}
 
 		var cluster orb.OrbCluster
 		cluster, err = getOrbCluster()
 
 		if err != nil {
+			closeRunSources(sources)
 			log.Fatal(err)
 		}
 
-		cluster.Config().Image.Name = runImage
+		// Sources become orbs of this cluster, each mounted from its own path
+		cfg := cluster.Config()
+		for _, source := range sources {
+			cfg.Orbs = lo.Reject(cfg.Orbs, func(o orb.OrbCfg, _ int) bool { return o.Name == source.orb.Name })
+			cfg.Orbs = append(cfg.Orbs, source.orb)
+		}
+
+		// The workspace's Postgres version is respected unless the image is given explicitly
+		if cmd.Flags().Changed("image") || cluster.Config().PostgresVersion == 0 {
+			cluster.Config().Image.Name = runImage
+		}
 
 		ctx := context.Background()
 
@@ -68,27 +87,28 @@ var runCmd = &cobra.Command{
 			AutoRemove: true,
 			Listeners: []orb.OrbStartEventListener{{
 				Ready: func(cluster orb.OrbCluster) {
+					databaseForOrb := func(orbName string) string { return orbName }
 
+					// This runs in its own goroutine, log.Fatal would leave the container behind.
+					// The cluster is freshly created, so resetting drops no existing database.
 					err := assembleOrbs(
 						ctx,
 						cluster,
 						true,
 						orbs,
-						func(orbName string) string { return orbName },
+						databaseForOrb,
 					)
 
+					// The cluster keeps running, so that the failure can be investigated
 					if err != nil {
-						log.Fatal(err)
-					}
-
-					if err != nil {
-						log.Fatal(err)
+						log.Error("Could not assemble orbs", "err", err)
 					}
 
 					var endpoints []orb.Endpoint
 					endpoints, err = cluster.Endpoints(ctx)
 					if err != nil {
-						log.Fatal(err)
+						log.Error("Could not list endpoints", "err", err)
+						return
 					}
 
 					rows := make([][]string, 0)
@@ -122,14 +142,108 @@ var runCmd = &cobra.Command{
 		err = cluster.StartWithCurrentUser(ctx, options)
 
 		if err != nil {
+			closeRunSources(sources)
 			log.Fatal(err)
 		}
 	},
 }
 
+// runSource is an orb coming from a source given to `run`
+type runSource struct {
+	dir src.SourceDirectory
+	// orb is named after the database the orb is assembled into and
+	// points to the orb directory in the source
+	orb orb.OrbCfg
+}
+
+// resolveRunSources resolves every `[name=]source` argument. If one fails,
+// the sources resolved so far are closed.
+func resolveRunSources(args []string) (sources []runSource, err error) {
+	defer func() {
+		if err != nil {
+			closeRunSources(sources)
+			sources = nil
+		}
+	}()
+	for _, arg := range args {
+		var source runSource
+		source, err = resolveRunSource(arg)
+		if err != nil {
+			return
+		}
+		sources = append(sources, source)
+		if len(lo.Filter(sources, func(s runSource, _ int) bool { return s.orb.Name == source.orb.Name })) > 1 {
+			err = fmt.Errorf("orb %s is given more than once, name sources with name=source", source.orb.Name)
+			return
+		}
+	}
+	return
+}
+
+func closeRunSources(sources []runSource) {
+	for _, source := range sources {
+		if err := source.dir.Close(); err != nil {
+			log.Warnf("Could not clean up %s: %v", source.dir.Path(), err)
+		}
+	}
+}
+
+// resolveRunSource resolves a `[name=]source` argument. Without a name, the
+// database is named after the orb found in the source.
+//
+// If the source is a workspace that configures the orb, its configuration is used.
+func resolveRunSource(arg string) (source runSource, err error) {
+	name, input := arg, arg
+	if before, after, ok := strings.Cut(arg, "="); ok && validateOrbName(before) == nil && !strings.Contains(before, ":") {
+		name, input = before, after
+	} else {
+		name = ""
+	}
+
+	source.dir, err = src.GetSourceDirectory(input)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = source.dir.Close()
+		}
+	}()
+
+	var dir string
+	dir, err = filepath.Abs(source.dir.Path())
+	if err != nil {
+		return
+	}
+
+	var orbName string
+	if named, ok := source.dir.(src.NamedSourceDirectory); ok {
+		orbName = named.Name()
+	} else {
+		orbName = filepath.Base(dir)
+	}
+
+	var cfg *orb.Config
+	cfg, err = orb.LoadConfig(dir)
+	if err != nil {
+		return
+	}
+	source.orb = orb.OrbCfg{Name: orbName}
+	if orbCfg, ok := cfg.Orb(orbName); ok {
+		source.orb = orbCfg
+	}
+	source.orb.Path = source.orb.HostPath(dir)
+	if name != "" {
+		source.orb.Name = name
+	}
+	return
+}
+
 var runImage string
+var listSources bool
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().StringVarP(&runImage, "image", "i", orb.NewConfig().Image.Name, "The Omnigres image to use")
+	runCmd.Flags().BoolVar(&listSources, "list-sources", false, "list supported sources and exit")
 }
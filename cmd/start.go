@@ -2,15 +2,33 @@ package cmd
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/charmbracelet/log"
 	"github.com/omnigres/cli/orb"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start cluster",
+	Long: `Starts the cluster in the background and prints its endpoints once it is ready.
+
+With --assemble, --migrate and/or --seed, all configured orbs are assembled,
+migrated and seeded once the cluster is ready, in this order. The command
+fails if any orb fails.
+
+Seeds are SQL files in the seed directory of the orb (next to src), such as
+<orb>/seed/users.sql. They are assembled into the orb's database like src,
+retrying statements whose dependencies are missing, so their order does not
+matter. They are applied on every start with --seed, so they should be
+idempotent (e.g. insert ... on conflict do nothing). Orbs without a seed
+directory are skipped.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var cluster orb.OrbCluster
 		var err error
@@ -20,37 +38,183 @@ var startCmd = &cobra.Command{
 		}
 
 		ctx := context.Background()
-
-		readyCh := make(chan orb.OrbCluster, 1)
-		err = cluster.StartWithCurrentUser(ctx, orb.OrbClusterStartOptions{Runfile: true, Listeners: []orb.OrbStartEventListener{
-			{Ready: func(cluster orb.OrbCluster) {
-				readyCh <- cluster
-			}}}})
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = cluster.Config().Save()
+		err = startCluster(ctx, cluster)
 		if err != nil {
 			log.Fatal(err)
 		}
+	},
+}
 
-		<-readyCh
+// startCluster starts the cluster in the background and prints its endpoints once it is ready
+func startCluster(ctx context.Context, cluster orb.OrbCluster) (err error) {
+	err = recreateIfDrifted(ctx, cluster)
+	if err != nil {
+		return
+	}
 
-		log.Info("Omnigres Orb cluster started.")
+	readyCh := make(chan orb.OrbCluster, 1)
+	err = cluster.StartWithCurrentUser(ctx, orb.OrbClusterStartOptions{
+		Runfile:     true,
+		WaitTimeout: waitTimeout,
+		NoWait:      noWait,
+		WaitHTTP:    waitHTTP,
+		Listeners: []orb.OrbStartEventListener{{
+			Stage: func(cluster orb.OrbCluster, stage orb.ReadinessStage) {
+				log.Infof("✓ %s", stage)
+			},
+			Ready: func(cluster orb.OrbCluster) {
+				readyCh <- cluster
+			},
+		}},
+	})
+	// The configuration is saved even if the cluster did not become ready,
+	// as starting may have recorded the image and the workspace identity
+	if saveErr := cluster.Config().Save(); err == nil {
+		err = saveErr
+	}
+	var readinessErr *orb.ReadinessError
+	if errors.As(err, &readinessErr) {
+		log.Error("The cluster did not become ready, consider a longer --wait-timeout", "stage", readinessErr.Stage.String())
+	}
+	if err != nil {
+		return
+	}
+
+	if noWait {
+		log.Info("Omnigres Orb cluster is starting, not waiting for it to become ready.")
+		return
+	}
+
+	<-readyCh
+
+	log.Info("Omnigres Orb cluster started.")
+
+	// Orbs failing to boot don't prevent printing endpoints
+	bootErr := bootOrbs(ctx, cluster)
+
+	var endpoints []orb.Endpoint
+	endpoints, err = cluster.Endpoints(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, endpoint := range endpoints {
+		fmt.Printf("%s (%s): %s\n", endpoint.Database, endpoint.Protocol, endpoint.String())
+	}
+	err = bootErr
+	return
+}
 
-		var endpoints []orb.Endpoint
-		endpoints, err = cluster.Endpoints(ctx)
+// bootOrbs assembles, migrates and seeds all configured orbs, as requested on the command line
+func bootOrbs(ctx context.Context, cluster orb.OrbCluster) (err error) {
+	orbs := lo.Map(cluster.Config().Orbs, func(cfg orb.OrbCfg, _ int) string { return cfg.Name })
+	if len(orbs) == 0 {
+		return
+	}
+
+	var errs []error
+	if startAssemble {
+		errs = append(errs, assembleOrbs(ctx, cluster, false, orbs, func(orbName string) string { return orbName }))
+	}
+	if startMigrate {
+		errs = append(errs, migrateRevisions(ctx, cluster, orbs))
+	}
+	if startSeed {
+		errs = append(errs, seedOrbs(ctx, cluster, orbs))
+	}
+	return errors.Join(errs...)
+}
+
+// seedOrbs assembles the seed directory of every orb that has one into its database
+func seedOrbs(ctx context.Context, cluster orb.OrbCluster, orbs []string) (err error) {
+	var path string
+	path, err = getOrbPath(false)
+	if err != nil {
+		return
+	}
+
+	var db *sql.DB
+	db, err = cluster.Connect(ctx, "omnigres")
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	var errs []error
+	for _, orbName := range orbs {
+		orbCfg, _ := cluster.Config().Orb(orbName)
+		if _, statErr := os.Stat(filepath.Join(orbCfg.HostPath(path), "seed")); statErr != nil {
+			log.Debug("Orb has no seed directory", "orb", orbName)
+			continue
+		}
+		log.Infof("Seeding orb %s", orbName)
+		err = assembleSchema(ctx, db, cluster.OrbPath(orbName), "seed", orbName)
 		if err != nil {
-			log.Fatal(err)
+			log.Error(err)
+			errs = append(errs, err)
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		for _, endpoint := range endpoints {
-			fmt.Printf("%s (%s): %s\n", endpoint.Database, endpoint.Protocol, endpoint.String())
-		}
+// recreateIfDrifted explains how the cluster's container differs from what
+// the configuration would create and offers to recreate it
+func recreateIfDrifted(ctx context.Context, cluster orb.OrbCluster) (err error) {
+	var drift []orb.Drift
+	drift, err = cluster.Drift(ctx)
+	if err != nil || len(drift) == 0 {
+		return
+	}
+	log.Warn("The container does not match the configuration")
+	for _, d := range drift {
+		log.Warn(d.String())
+	}
 
-	},
+	var ok bool
+	ok, err = confirm(recreateQuestion(cluster))
+	if errors.Is(err, errNoTerminal) {
+		log.Warn("Keeping the container as it is, use 'omnigres restart --recreate' to recreate it")
+		return nil
+	}
+	if err != nil || !ok {
+		return
+	}
+	// Give Postgres a chance to shut down cleanly
+	_ = cluster.Stop(ctx)
+	return cluster.Remove(ctx)
+}
+
+// recreateQuestion asks to recreate the container, telling whether data survives it
+func recreateQuestion(cluster orb.OrbCluster) string {
+	if volume := cluster.Config().Volume; volume != "" {
+		return fmt.Sprintf("Recreate the container? Data is kept in volume %s.", volume)
+	}
+	return "Recreate the container? This discards the data in it."
+}
+
+var startAssemble bool
+var startMigrate bool
+var startSeed bool
+
+var waitTimeout time.Duration
+var noWait bool
+var waitHTTP bool
+
+// addWaitFlags adds flags controlling how long to wait for the cluster to become ready
+func addWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", orb.DefaultWaitTimeout, "how long to wait for the cluster to become ready")
+	cmd.Flags().BoolVar(&noWait, "no-wait", false, "return once the container is up, without waiting for the cluster to become ready")
+	cmd.Flags().BoolVar(&waitHTTP, "wait-http", false, "also wait until HTTP listeners respond")
+	cmd.MarkFlagsMutuallyExclusive("no-wait", "wait-http")
 }
 
 func init() {
 	rootCmd.AddCommand(startCmd)
+	addWaitFlags(startCmd)
+	startCmd.Flags().BoolVar(&startAssemble, "assemble", false, "assemble all orbs once the cluster is ready")
+	startCmd.Flags().BoolVar(&startMigrate, "migrate", false, "migrate revisions of all orbs once the cluster is ready")
+	startCmd.Flags().BoolVar(&startSeed, "seed", false, "assemble the SQL files in <orb>/seed into every orb's database once the cluster is ready")
+	startCmd.MarkFlagsMutuallyExclusive("no-wait", "assemble")
+	startCmd.MarkFlagsMutuallyExclusive("no-wait", "migrate")
+	startCmd.MarkFlagsMutuallyExclusive("no-wait", "seed")
 }
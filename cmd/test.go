@@ -7,12 +7,16 @@ import (
 	"fmt"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"os"
-	"path"
 	"time"
 
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
 	"github.com/charmbracelet/log"
+	"github.com/lib/pq"
 	"github.com/omnigres/cli/orb"
+	"github.com/omnigres/cli/tui"
 	"github.com/relvacode/iso8601"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 )
 
@@ -46,71 +50,221 @@ var testCmd = &cobra.Command{
 			return fmt.Sprintf("%s_%s_%s", orbName, "test", t)
 		}
 
-		err = testOrbs(ctx, cluster, orbs, nameForTestDatabase)
+		if len(testMatrix) > 0 {
+			var results map[int]map[string]testResult
+			results, err = testVersions(ctx, cluster.Config(), testMatrix, orbs, nameForTestDatabase)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !printTestMatrix(testMatrix, orbs, results) {
+				os.Exit(1)
+			}
+			return
+		}
+
+		var results map[string]testResult
+		results, err = testOrbs(ctx, cluster, orbs, nameForTestDatabase)
 
 		if err != nil {
 			log.Fatal(err)
 		}
+		for _, result := range results {
+			if !result.ok() {
+				os.Exit(1)
+			}
+		}
 	},
 }
 
+// testResult tallies the tests of an orb
+type testResult struct {
+	Passed int
+	Failed int
+	// Err is set when the orb could not be tested
+	Err error
+}
+
+func (r testResult) ok() bool {
+	return r.Err == nil && r.Failed == 0
+}
+
+func (r testResult) String() string {
+	switch {
+	case r.Err != nil:
+		return "💥 error"
+	case r.Failed > 0:
+		return fmt.Sprintf("🔴 %d/%d failed", r.Failed, r.Passed+r.Failed)
+	default:
+		return fmt.Sprintf("✅ %d passed", r.Passed)
+	}
+}
+
+// testVersions tests orbs on an ephemeral cluster for every major Postgres version
+func testVersions(
+	ctx context.Context,
+	cfg *orb.Config,
+	versions []int,
+	orbs []string,
+	databaseForOrb func(string) string,
+) (results map[int]map[string]testResult, err error) {
+	results = make(map[int]map[string]testResult)
+	for _, version := range versions {
+		log.Infof("=== Postgres %d ===", version)
+		results[version], err = testVersion(ctx, cfg.WithPostgresVersion(version), orbs, databaseForOrb)
+		if err != nil {
+			log.Error("Could not test", "postgres", version, "err", err)
+			results[version] = lo.SliceToMap(orbs, func(orbName string) (string, testResult) {
+				return orbName, testResult{Err: err}
+			})
+			err = nil
+		}
+	}
+	return
+}
+
+// testVersion tests orbs on an ephemeral cluster that is removed afterwards
+func testVersion(
+	ctx context.Context,
+	cfg *orb.Config,
+	orbs []string,
+	databaseForOrb func(string) string,
+) (results map[string]testResult, err error) {
+	var orbPath string
+	orbPath, err = getOrbPath(false)
+	if err != nil {
+		return
+	}
+	var cluster orb.OrbCluster
+	cluster, err = orb.NewDockerOrbCluster()
+	if err != nil {
+		return
+	}
+	defer cluster.Close()
+	err = cluster.Configure(orb.OrbOptions{
+		Config:   cfg,
+		Path:     orbPath,
+		Progress: tui.ProgressOptions{NoTUI: noTUI, JSON: jsonProgress, Layers: layerProgress},
+	})
+	if err != nil {
+		return
+	}
+
+	readyCh := make(chan orb.OrbCluster, 1)
+	err = cluster.StartWithCurrentUser(ctx, orb.OrbClusterStartOptions{
+		Runfile:    false,
+		AutoRemove: true,
+		Listeners: []orb.OrbStartEventListener{{Ready: func(cluster orb.OrbCluster) {
+			readyCh <- cluster
+		}}},
+	})
+	if err != nil {
+		return
+	}
+	defer func() {
+		if stopErr := cluster.Stop(ctx); stopErr != nil {
+			log.Warn("Could not stop the cluster", "err", stopErr)
+		}
+	}()
+
+	<-readyCh
+
+	results, err = testOrbs(ctx, cluster, orbs, databaseForOrb)
+	return
+}
+
+// printTestMatrix prints results of every orb for every version and reports whether all passed
+func printTestMatrix(versions []int, orbs []string, results map[int]map[string]testResult) (ok bool) {
+	ok = true
+	headers := []string{"Orb"}
+	for _, version := range versions {
+		headers = append(headers, fmt.Sprintf("Postgres %d", version))
+	}
+	rows := make([][]string, 0)
+	for _, orbName := range orbs {
+		row := []string{orbName}
+		for _, version := range versions {
+			result := results[version][orbName]
+			ok = ok && result.ok()
+			row = append(row, result.String())
+		}
+		rows = append(rows, row)
+	}
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("99"))).
+		Headers(headers...).
+		Rows(rows...)
+
+	fmt.Println(t)
+	return
+}
+
 func testOrbs(
 	ctx context.Context,
 	cluster orb.OrbCluster,
 	orbs []string,
 	databaseForOrb func(string) string,
-) (err error) {
+) (results map[string]testResult, err error) {
 
-	var testTarget, testRunner *sql.DB
+	results = make(map[string]testResult)
+	var testRunner *sql.DB
 	testRunner, err = cluster.Connect(ctx, "omnigres")
 	if err != nil {
 		log.Error("Could not connect to orb. Ensure the docker container is running, perhaps 'omnigres start' will fix it.")
 		return
 	}
+	defer testRunner.Close()
+	err = checkExtensionsAvailable(ctx, testRunner, cluster, orbs)
+	if err != nil {
+		return
+	}
 
-	testOrb := func(orbName string) error {
+	// testOrb has its own err, so that a failing orb doesn't fail the others
+	testOrb := func(orbName string, result *testResult) (err error) {
 		dbName := databaseForOrb(orbName)
+		var testTarget *sql.DB
 		testTarget, err = cluster.Connect(ctx, dbName)
 		if err != nil {
-			return err
+			return
 		}
+		defer testTarget.Close()
 		log.Debug("Testing orb", "orbName", orbName, "dbName", dbName)
 
 		_, err = testRunner.ExecContext(ctx, fmt.Sprintf(`create database %q`, dbName))
 		if err != nil {
-			log.Fatal(err)
+			return
 		}
+		defer func() {
+			// the database can't be dropped while connected to, even if testing failed early
+			testTarget.Close()
+			cleanErr := dropTestDatabase(ctx, testRunner, dbName)
+			if cleanErr != nil {
+				log.Error("Could not drop the test database", "database", dbName, "err", cleanErr)
+				if err == nil {
+					err = cleanErr
+				}
+			}
+		}()
+
 		_, err = testRunner.ExecContext(
 			ctx,
 			"update pg_database set datistemplate = true where datname = $1",
 			dbName,
 		)
 		if err != nil {
-			return err
+			return
 		}
-		cleanTestRunner := func() {
-			// remove istemplate so we can drop the database
-			_, err = testRunner.ExecContext(
-				ctx,
-				"update pg_database set datistemplate = false where datname = $1",
-				dbName,
-			)
-			if err != nil {
-				log.Fatal(err)
-			}
 
-			_, err = testRunner.ExecContext(
-				ctx,
-				fmt.Sprintf("drop database \"%s\"", dbName),
-			)
-			if err != nil {
-				log.Fatal(err)
-			}
+		err = installExtensions(ctx, cluster, orbName, dbName)
+		if err != nil {
+			return err
 		}
-		defer cleanTestRunner()
 
-		orbSource := path.Join(orbName, "src")
-		assembleSchema(ctx, testRunner, orbSource, dbName)
+		err = assembleSchema(ctx, testRunner, cluster.OrbPath(orbName), "src", dbName)
+		if err != nil {
+			return err
+		}
 
 		_, err = testTarget.ExecContext(ctx, "create extension omni_test cascade")
 		if err != nil {
@@ -125,8 +279,10 @@ func testOrbs(
 		defer conn.Close()
 
 		// assemble tests in target db
-		orbTestSource := path.Join(orbName, "tests")
-		assembleSchema(ctx, testRunner, orbTestSource, dbName)
+		err = assembleSchema(ctx, testRunner, cluster.OrbPath(orbName), "tests", dbName)
+		if err != nil {
+			return err
+		}
 
 		// run tests
 		log.Infof("")
@@ -153,6 +309,15 @@ func testOrbs(
 			if err != nil {
 				return err
 			}
+			if error_message.Valid {
+				result.Failed++
+			} else {
+				result.Passed++
+			}
+		}
+		err = testRows.Err()
+		if err != nil {
+			return err
 		}
 		log.Info("===================================================================")
 
@@ -160,14 +325,31 @@ func testOrbs(
 	}
 
 	for _, orbName := range orbs {
-		err := testOrb(orbName)
+		var result testResult
+		err := testOrb(orbName, &result)
 		if err != nil {
 			log.Error(err)
+			result.Err = err
 		}
+		results[orbName] = result
 	}
 	return
 }
 
+// dropTestDatabase drops a test database, which is marked as a template while testing
+func dropTestDatabase(ctx context.Context, testRunner *sql.DB, dbName string) (err error) {
+	_, err = testRunner.ExecContext(
+		ctx,
+		"update pg_database set datistemplate = false where datname = $1",
+		dbName,
+	)
+	if err != nil {
+		return
+	}
+	_, err = testRunner.ExecContext(ctx, fmt.Sprintf("drop database %s", pq.QuoteIdentifier(dbName)))
+	return
+}
+
 type testPassed struct {
 	Name        string       `json:"name"`
 	Description string       `json:"description"`
@@ -183,8 +365,11 @@ type testFailed struct {
 	Error       string       `json:"error"`
 }
 
+var testMatrix []int
+
 func init() {
 	rootCmd.AddCommand(testCmd)
+	testCmd.Flags().IntSliceVar(&testMatrix, "matrix", nil, "test on an ephemeral cluster for each of the major Postgres versions (e.g. 15,16,17)")
 
 	handler := cloudeventHandler{
 		Callback: func(e *cloudevents.Event) {
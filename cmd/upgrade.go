@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"github.com/lib/pq"
+	"github.com/omnigres/cli/orb"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade --to <image>",
+	Short: "Move the cluster to another image",
+	Long: `Moves the cluster to another image, typically one with a newer major
+Postgres version (e.g. ghcr.io/omnigres/omnigres-17).
+
+If the data is kept in a volume and both images are Omnigres images, the
+new one of a newer major Postgres version, the data is upgraded into a new
+volume with pg_upgrade, using the old binaries copied out of the old image.
+The old volume is kept.
+
+Otherwise, every orb database is dumped into the workspace's backups
+directory, a new container is started on the new image and the dumps are
+restored into it. If a volume is configured, the new cluster gets a new
+volume and the old one is kept.
+
+If anything fails, the new container is removed and the old one is started
+again. Otherwise, the old container is removed and omnigres.yaml is updated.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var cluster orb.OrbCluster
+		var err error
+		cluster, err = getOrbCluster()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+
+		version, isOmnigresImage := orb.PostgresVersionOf(upgradeImage)
+		if !isOmnigresImage && cluster.Config().PostgresVersion != 0 {
+			// postgres_version would select its own image again
+			log.Fatalf("%s is not an Omnigres image, remove postgres_version from omnigres.yaml to use it", upgradeImage)
+		}
+
+		if cluster.CanUpgradeInPlace(upgradeImage) {
+			var ok bool
+			ok, err = confirm(fmt.Sprintf("Upgrade the cluster to %s with pg_upgrade? The data is upgraded into a new volume.", upgradeImage))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !ok {
+				log.Fatal("Upgrade aborted")
+			}
+			err = cluster.Upgrade(ctx, upgradeImage, nil)
+		} else {
+			err = upgradeWithDumps(ctx, cluster)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg := cluster.Config()
+		if isOmnigresImage {
+			cfg.PostgresVersion = version
+		}
+		err = cfg.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Upgraded to %s", upgradeImage)
+	},
+}
+
+// upgradeWithDumps dumps orb databases and restores them into the cluster running on the new image
+func upgradeWithDumps(ctx context.Context, cluster orb.OrbCluster) (err error) {
+	var databases []string
+	databases, err = orbDatabases(ctx, cluster)
+	if err != nil {
+		log.Error("Could not connect to the cluster. Ensure it is running, perhaps 'omnigres start' will fix it.")
+		return
+	}
+
+	var ok bool
+	ok, err = confirm(fmt.Sprintf("Upgrade the cluster to %s? Databases %v will be dumped and restored.", upgradeImage, databases))
+	if err != nil {
+		return
+	}
+	if !ok {
+		err = errors.New("upgrade aborted")
+		return
+	}
+
+	dumps := make(map[string]string)
+	for _, dbName := range databases {
+		dumps[dbName], err = backupDatabase(ctx, cluster, dbName)
+		if err != nil {
+			return
+		}
+	}
+
+	return cluster.Upgrade(ctx, upgradeImage, func(cluster orb.OrbCluster) error {
+		return restoreDatabases(ctx, cluster, databases, dumps)
+	})
+}
+
+// orbDatabases returns the databases of configured orbs that exist in the cluster
+func orbDatabases(ctx context.Context, cluster orb.OrbCluster) (databases []string, err error) {
+	var db *sql.DB
+	db, err = cluster.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	var rows *sql.Rows
+	rows, err = db.QueryContext(ctx, `select datname from pg_database where datname = any($1) order by datname`,
+		pq.Array(lo.Map(cluster.Config().Orbs, func(o orb.OrbCfg, _ int) string { return o.Name })))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var datname string
+		if err = rows.Scan(&datname); err != nil {
+			return
+		}
+		databases = append(databases, datname)
+	}
+	err = rows.Err()
+	return
+}
+
+// restoreDatabases creates the databases and restores their dumps
+func restoreDatabases(ctx context.Context, cluster orb.OrbCluster, databases []string, dumps map[string]string) (err error) {
+	var db *sql.DB
+	db, err = cluster.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	for _, dbName := range databases {
+		var exists bool
+		err = db.QueryRowContext(ctx, `select exists(select from pg_database where datname = $1)`, dbName).Scan(&exists)
+		if err != nil {
+			return
+		}
+		if !exists {
+			_, err = db.ExecContext(ctx, fmt.Sprintf("create database %s", pq.QuoteIdentifier(dbName)))
+			if err != nil {
+				return
+			}
+		}
+
+		log.Infof("Restoring %s from %s", dbName, dumps[dbName])
+		var file *os.File
+		file, err = os.Open(dumps[dbName])
+		if err != nil {
+			return
+		}
+		err = cluster.Restore(ctx, dbName, file)
+		_ = file.Close()
+		if err != nil {
+			err = fmt.Errorf("could not restore %s: %w", dbName, err)
+			return
+		}
+	}
+	return
+}
+
+var upgradeImage string
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+	upgradeCmd.Flags().StringVar(&upgradeImage, "to", "", "image to upgrade to (e.g. ghcr.io/omnigres/omnigres-17)")
+	_ = upgradeCmd.MarkFlagRequired("to")
+}
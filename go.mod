@@ -3,13 +3,14 @@ module github.com/omnigres/cli
 go 1.23
 
 require (
-	github.com/PuerkitoBio/goquery v1.10.1
 	github.com/charmbracelet/bubbletea v1.1.0
 	github.com/charmbracelet/lipgloss v1.0.0
 	github.com/charmbracelet/log v0.4.0
 	github.com/cloudevents/sdk-go/v2 v2.15.2
 	github.com/docker/docker v27.4.1+incompatible
+	github.com/docker/go-units v0.5.0
 	github.com/lib/pq v1.10.9
+	github.com/moby/patternmatcher v0.6.0
 	github.com/relvacode/iso8601 v1.6.0
 	github.com/samber/lo v1.47.0
 	github.com/spf13/cobra v1.8.1
@@ -35,14 +36,12 @@ require (
 
 require (
 	github.com/Microsoft/go-winio v0.6.2 // indirect
-	github.com/andybalholm/cascadia v1.3.3 // indirect
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
 	github.com/charmbracelet/bubbles v0.20.0
 	github.com/charmbracelet/x/ansi v0.4.5 // indirect
 	github.com/containerd/log v0.1.0 // indirect
 	github.com/distribution/reference v0.6.0 // indirect
 	github.com/docker/go-connections v0.5.0 // indirect
-	github.com/docker/go-units v0.5.0 // indirect
 	github.com/felixge/httpsnoop v1.0.4 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/go-logfmt/logfmt v0.6.0 // indirect
@@ -0,0 +1,361 @@
+package orb
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// buildContext describes everything needed to build a custom image. It's
+// written as a deterministic tar archive, both to hash it and to stream it
+// to docker, so it's never held in memory as a whole.
+type buildContext struct {
+	dockerfile string
+	// generated is the content of the generated Dockerfile, if any
+	generated []byte
+	dirs      []contextDirectory
+}
+
+// contextDirectory is a workspace directory added to the build context under prefix
+type contextDirectory struct {
+	workspace string
+	dir       string
+	prefix    string
+	// ignore excludes files by their path relative to dir
+	ignore func(rel string, isDir bool) (ignored bool, skipDir bool, err error)
+}
+
+// workspaceState are files of the workspace that never go into a build
+// context: its configuration, runtime state, backups and secrets
+func workspaceState(rel string) bool {
+	switch {
+	case rel == "omnigres.yaml", rel == "omnigres.run.yaml":
+		return true
+	case rel == "backups", strings.HasPrefix(rel, "backups/"):
+		return true
+	case path.Base(rel) == ".env":
+		return true
+	}
+	return false
+}
+
+// dockerIgnore reads patterns of the .dockerignore in dir, if there's one
+func dockerIgnore(dir string) (pm *patternmatcher.PatternMatcher, err error) {
+	var f *os.File
+	f, err = os.Open(filepath.Join(dir, ".dockerignore"))
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var patterns []string
+	patterns, err = ignorefile.ReadAll(f)
+	if err != nil {
+		return
+	}
+	pm, err = patternmatcher.New(patterns)
+	return
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, mode fs.FileMode, content io.Reader) (err error) {
+	err = tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: int64(mode.Perm()),
+		Size: size,
+	})
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(tw, content)
+	return
+}
+
+// writeDirectory writes the directory's regular files under its prefix
+func writeDirectory(tw *tar.Writer, d contextDirectory) (err error) {
+	return filepath.WalkDir(d.dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return fs.SkipDir
+		}
+		inWorkspace, err := filepath.Rel(d.workspace, p)
+		if err != nil {
+			return err
+		}
+		if workspaceState(filepath.ToSlash(inWorkspace)) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(d.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && d.ignore != nil {
+			ignored, skipDir, err := d.ignore(rel, entry.IsDir())
+			if err != nil {
+				return err
+			}
+			if skipDir {
+				return fs.SkipDir
+			}
+			if ignored {
+				return nil
+			}
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return writeTarFile(tw, path.Join(d.prefix, rel), info.Size(), info.Mode(), f)
+	})
+}
+
+// writeTo writes the build context as a tar archive
+func (c *buildContext) writeTo(w io.Writer) (err error) {
+	tw := tar.NewWriter(w)
+	for _, d := range c.dirs {
+		err = writeDirectory(tw, d)
+		if err != nil {
+			return
+		}
+	}
+	if c.generated != nil {
+		err = writeTarFile(tw, c.dockerfile, int64(len(c.generated)), 0o644, bytes.NewReader(c.generated))
+		if err != nil {
+			return
+		}
+	}
+	return tw.Close()
+}
+
+// newImageBuildContext prepares the build context for the workspace's custom image
+func newImageBuildContext(workspace string, build *ImageBuild) (c *buildContext, err error) {
+	c = &buildContext{}
+
+	if build.Dockerfile != "" {
+		dockerfile := filepath.Join(workspace, build.Dockerfile)
+		dir := filepath.Dir(dockerfile)
+		c.dockerfile = filepath.Base(dockerfile)
+
+		var pm *patternmatcher.PatternMatcher
+		pm, err = dockerIgnore(dir)
+		if err != nil {
+			err = fmt.Errorf("could not read .dockerignore: %w", err)
+			return
+		}
+
+		c.dirs = append(c.dirs, contextDirectory{
+			workspace: workspace,
+			dir:       dir,
+			ignore: func(rel string, isDir bool) (ignored bool, skipDir bool, err error) {
+				// Like docker, the Dockerfile and .dockerignore are always sent
+				if pm == nil || rel == c.dockerfile || rel == ".dockerignore" {
+					return
+				}
+				ignored, err = pm.MatchesOrParentMatches(rel)
+				// Exclusions may bring back files of an ignored directory
+				skipDir = ignored && isDir && !pm.Exclusions()
+				return
+			},
+		})
+	} else {
+		var dockerfile strings.Builder
+		dockerfile.WriteString("ARG BASE_IMAGE\nFROM ${BASE_IMAGE}\nUSER root\n")
+
+		packages := build.Packages
+		if len(build.Extensions) > 0 {
+			packages = append([]string{"build-essential"}, packages...)
+		}
+		if len(packages) > 0 {
+			fmt.Fprintf(&dockerfile,
+				"RUN apt-get update && apt-get install -y --no-install-recommends %s && rm -rf /var/lib/apt/lists/*\n",
+				strings.Join(packages, " "))
+		}
+
+		for i, ext := range build.Extensions {
+			prefix := fmt.Sprintf("extensions/%d-%s", i, filepath.Base(ext))
+			dir := filepath.Join(workspace, ext)
+			if !isDirectory(dir) {
+				err = fmt.Errorf("could not add extension sources %s: not a directory", ext)
+				return
+			}
+			c.dirs = append(c.dirs, contextDirectory{workspace: workspace, dir: dir, prefix: prefix})
+			fmt.Fprintf(&dockerfile, "COPY %s /tmp/%s\n", prefix, prefix)
+			fmt.Fprintf(&dockerfile, "RUN make -C /tmp/%s USE_PGXS=1 install && rm -rf /tmp/%s\n", prefix, prefix)
+		}
+
+		c.dockerfile = "Dockerfile"
+		c.generated = []byte(dockerfile.String())
+	}
+	return
+}
+
+func isDirectory(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// buildTag returns the tag for the workspace's custom image built from inputs with the given hash
+func (d *DockerOrbCluster) buildTag(hash string) string {
+	return fmt.Sprintf("omnigres-%s:%s", d.project(), hash)
+}
+
+// baseImageID returns the ID of the locally available base image, pulling
+// it first if asked to. Images missing locally have no ID.
+func (d *DockerOrbCluster) baseImageID(ctx context.Context, base string, pull bool) (id string, err error) {
+	var img types.ImageInspect
+	img, _, err = d.client.ImageInspectWithRaw(ctx, base)
+	if errdefs.IsNotFound(err) && pull {
+		_, err = d.PullImage(ctx, base)
+		if err != nil {
+			return
+		}
+		img, _, err = d.client.ImageInspectWithRaw(ctx, base)
+	}
+	if errdefs.IsNotFound(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	id = img.ID
+	return
+}
+
+// imageBuild prepares the build context of the custom image and its tag. The
+// base image is pulled if it's not available locally and pullBase is set.
+func (d *DockerOrbCluster) imageBuild(ctx context.Context, pullBase bool) (bc *buildContext, tag string, err error) {
+	cfg := d.Config()
+	build := cfg.Image.Build
+	if build == nil {
+		err = errors.New("no image build is configured")
+		return
+	}
+	if build.Base == "" {
+		build.Base = cfg.Image.Name
+	}
+
+	var baseID string
+	baseID, err = d.baseImageID(ctx, build.Base, pullBase)
+	if err != nil {
+		return
+	}
+
+	bc, err = newImageBuildContext(d.Path, build)
+	if err != nil {
+		return
+	}
+	// The base image is an input, too, including what its tag resolves to
+	hash := sha256.New()
+	hash.Write([]byte(build.Base + "\n" + baseID + "\n"))
+	err = bc.writeTo(hash)
+	if err != nil {
+		return
+	}
+	tag = d.buildTag(hex.EncodeToString(hash.Sum(nil))[:12])
+	return
+}
+
+// BuildImage builds the custom image described in the configuration, unless
+// an image built from the same inputs already exists, and configures the
+// cluster to use it
+func (d *DockerOrbCluster) BuildImage(ctx context.Context, force bool) (tag string, err error) {
+	cfg := d.Config()
+	var bc *buildContext
+	bc, tag, err = d.imageBuild(ctx, true)
+	if err != nil {
+		return
+	}
+	build := cfg.Image.Build
+
+	cfg.Image.Name = tag
+	cfg.Image.Digest = ""
+
+	if !force {
+		_, _, err = d.client.ImageInspectWithRaw(ctx, tag)
+		if err == nil {
+			log.Debug("Custom image is up to date", "image", tag)
+			return
+		}
+		if !errdefs.IsNotFound(err) {
+			return
+		}
+	}
+
+	log.Info("Building image", "image", tag, "base", build.Base)
+	var response types.ImageBuildResponse
+	// The context is streamed, it's written again as it's read
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() { pw.CloseWithError(bc.writeTo(pw)) }()
+
+	response, err = d.client.ImageBuild(ctx, pr, types.ImageBuildOptions{
+		Tags:       []string{tag},
+		Dockerfile: bc.dockerfile,
+		BuildArgs:  map[string]*string{"BASE_IMAGE": &build.Base},
+		Remove:     true,
+		Labels:     d.labels(false),
+	})
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	err = reportBuild(response.Body)
+	return
+}
+
+// reportBuild prints docker's build output and returns the build error, if any
+func reportBuild(reader io.Reader) (err error) {
+	decoder := json.NewDecoder(reader)
+	for {
+		var message struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		err = decoder.Decode(&message)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+		if message.Error != "" {
+			return fmt.Errorf("image build failed: %s", message.Error)
+		}
+		fmt.Print(message.Stream)
+	}
+}
@@ -6,16 +6,23 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"time"
+
+	"github.com/omnigres/cli/tui"
 )
 
 type OrbOptions struct {
 	*Config
 	Path string
+	// Progress controls how image download progress is reported
+	Progress tui.ProgressOptions
 }
 
 type OrbStartEventListener struct {
 	Started func(cluster OrbCluster)
-	Ready   func(cluster OrbCluster)
+	// Stage is called for every readiness stage reached
+	Stage func(cluster OrbCluster, stage ReadinessStage)
+	Ready func(cluster OrbCluster)
 }
 
 type OrbRunEventListener struct {
@@ -31,6 +38,12 @@ type OrbClusterStartOptions struct {
 	AutoRemove bool
 	Listeners  []OrbStartEventListener
 	Runfile    bool
+	// WaitTimeout limits waiting for the cluster to become ready, DefaultWaitTimeout if zero
+	WaitTimeout time.Duration
+	// NoWait returns once the container is up, without waiting for readiness
+	NoWait bool
+	// WaitHTTP also waits until HTTP listeners respond
+	WaitHTTP bool
 }
 
 type OrbCluster interface {
@@ -41,8 +54,42 @@ type OrbCluster interface {
 	Endpoints(ctx context.Context) ([]Endpoint, error)
 	Connect(ctx context.Context, database ...string) (*sql.DB, error)
 	ConnectPsql(ctx context.Context, database ...string) error
+	Dump(ctx context.Context, database string, w io.Writer) error
+	// Restore runs a plain SQL dump in the database
+	Restore(ctx context.Context, database string, r io.Reader) error
 	Close() error
 	Config() *Config
+	// OrbPath returns the orb directory inside the cluster
+	OrbPath(name string) string
+	// Remove removes the cluster's container and forgets about it
+	Remove(ctx context.Context) error
+	PullImage(ctx context.Context, name string) (digest string, err error)
+	ImageDigest(ctx context.Context, name string) (digest string, err error)
+	Images(ctx context.Context) ([]ImageInfo, error)
+	RemoveImage(ctx context.Context, id string) error
+	// BuildImage builds the workspace's custom image, if its inputs have changed or if forced
+	BuildImage(ctx context.Context, force bool) (tag string, err error)
+	// Upgrade replaces the cluster's container with one running the image,
+	// calling restore once it is ready and rolling back if anything fails.
+	// Without restore, the data is upgraded in place with pg_upgrade.
+	Upgrade(ctx context.Context, image string, restore func(cluster OrbCluster) error) error
+	// CanUpgradeInPlace reports whether Upgrade can use pg_upgrade for the image
+	CanUpgradeInPlace(image string) bool
+	// Reload applies resources and Postgres parameters from the configuration
+	// to the running cluster, waiting up to waitTimeout if it has to be restarted
+	Reload(ctx context.Context, waitTimeout time.Duration) error
+	// Environment returns the environment of the cluster's container
+	Environment() ([]EnvVar, error)
+	// EnvironmentChanged reports whether the environment has changed since the container was created
+	EnvironmentChanged(ctx context.Context) (bool, error)
+	// Drift compares the cluster's container with what the configuration would create
+	Drift(ctx context.Context) ([]Drift, error)
+	// Down removes the cluster's container, runfile and unused network, and the data volume if asked to
+	Down(ctx context.Context, volumes bool) error
+	// Clusters lists clusters of all workspaces on the host
+	Clusters(ctx context.Context) ([]ClusterInfo, error)
+	// Repair finds the workspace's container by its labels and rewrites the runfile
+	Repair(ctx context.Context) (containerId string, err error)
 }
 
 type Endpoint struct {
@@ -1,50 +1,266 @@
 package orb
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/charmbracelet/log"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
 	"github.com/omnigres/cli/internal/fileutils"
 	"github.com/spf13/viper"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 )
 
 type Config struct {
+	// ID identifies the workspace, even when it is cloned elsewhere. Its
+	// cluster's container is labelled with it.
+	ID    string `yaml:",omitempty"`
 	Orbs  []OrbCfg
 	Image ImageConfig
-	path  string
+	// PostgresVersion is the major Postgres version, it selects the Omnigres image
+	PostgresVersion int `yaml:"postgres_version,omitempty" mapstructure:"postgres_version"`
+	// Resources limit the cluster's container
+	Resources Resources `yaml:",omitempty"`
+	// Postgres are postgresql.conf parameters, passed to Postgres on the
+	// command line when the container is created. Those added later are
+	// applied with ALTER SYSTEM when the cluster is reloaded, and keep their
+	// values until reset with ALTER SYSTEM RESET. Libraries in
+	// shared_preload_libraries are added to those preloaded by the image
+	// rather than replacing them.
+	Postgres map[string]string `yaml:",omitempty"`
+	// Env is passed to the cluster's container
+	Env map[string]string `yaml:",omitempty"`
+	// Secrets are variables read from files, relative to the workspace
+	Secrets map[string]string `yaml:",omitempty"`
+	// Volume is the docker volume keeping the cluster's data, so that it
+	// survives recreating the container. Without it, data lives in the container.
+	Volume string `yaml:",omitempty"`
+	path   string
+}
+
+// Resources of the cluster's container. Sizes are given as in docker, e.g. 512m or 2g.
+type Resources struct {
+	Memory string  `yaml:",omitempty"`
+	CPUs   float64 `yaml:",omitempty"`
+	// ShmSize is the size of /dev/shm, Postgres uses it for parallel queries
+	ShmSize string `yaml:"shm_size,omitempty" mapstructure:"shm_size"`
+}
+
+// hostResources converts the resources to the container's limits
+func (r Resources) hostResources() (resources container.Resources, shmSize int64, err error) {
+	if r.Memory != "" {
+		resources.Memory, err = units.RAMInBytes(r.Memory)
+		if err != nil {
+			err = fmt.Errorf("invalid memory limit: %w", err)
+			return
+		}
+	}
+	if r.ShmSize != "" {
+		shmSize, err = units.RAMInBytes(r.ShmSize)
+		if err != nil {
+			err = fmt.Errorf("invalid shm_size: %w", err)
+			return
+		}
+	}
+	if resources.Memory > 0 {
+		// Docker's default, set explicitly so that limits can be updated in place
+		resources.MemorySwap = 2 * resources.Memory
+	}
+	resources.NanoCPUs = int64(r.CPUs * 1e9)
+	return
 }
 
 type OrbCfg struct {
 	Name       string
 	Extensions []string
+	// Protected orbs never have their database dropped by the CLI
+	Protected bool `yaml:",omitempty"`
+	// Path to the orb directory, absolute or relative to the workspace.
+	// Defaults to the directory named after the orb in the workspace.
+	Path string `yaml:",omitempty"`
+	// Env is passed to the cluster's container, each variable prefixed with
+	// the orb name (<ORB>_<NAME>)
+	Env map[string]string `yaml:",omitempty"`
+	// Secrets are variables read from files, relative to the orb directory
+	Secrets map[string]string `yaml:",omitempty"`
+}
+
+// HostPath returns the orb directory on the host
+func (o OrbCfg) HostPath(workspace string) string {
+	switch {
+	case o.Path == "":
+		return filepath.Join(workspace, o.Name)
+	case filepath.IsAbs(o.Path):
+		return o.Path
+	default:
+		return filepath.Join(workspace, o.Path)
+	}
 }
 
 type ImageConfig struct {
 	Name   string
 	Digest string `mapstructure:",omitempty"`
+	// Build describes a custom image to build for the workspace. When set,
+	// Name is the tag of the image built most recently.
+	Build *ImageBuild `yaml:",omitempty"`
 }
 
+// ImageBuild describes a custom image built on top of a base Omnigres image
+type ImageBuild struct {
+	// Base image, defaults to the image configured before the first build
+	Base string `yaml:",omitempty"`
+	// Dockerfile to build, relative to the workspace. Its directory is the
+	// build context, and the base image is passed as BASE_IMAGE build argument.
+	// The context honors .dockerignore and never includes omnigres.yaml,
+	// omnigres.run.yaml, backups or .env files.
+	Dockerfile string `yaml:",omitempty"`
+	// Packages are Debian packages to install on top of the base image
+	Packages []string `yaml:",omitempty"`
+	// Extensions are directories (relative to the workspace) with extension
+	// sources to build and install using PGXS
+	Extensions []string `yaml:",omitempty"`
+}
+
+// DefaultPostgresVersion is the major Postgres version used unless configured otherwise
+const DefaultPostgresVersion = 17
+
+// PostgresImage returns the Omnigres image for the major Postgres version
+func PostgresImage(version int) string {
+	return fmt.Sprintf("ghcr.io/omnigres/omnigres-%d", version)
+}
+
+// PostgresVersionOf returns the major Postgres version of an Omnigres image, if it is one
+func PostgresVersionOf(image string) (version int, ok bool) {
+	match := postgresImagePattern.FindStringSubmatch(ImageRepository(image))
+	if match == nil {
+		return
+	}
+	version, err := strconv.Atoi(match[1])
+	ok = err == nil
+	return
+}
+
+var postgresImagePattern = regexp.MustCompile(`^ghcr\.io/omnigres/omnigres-(\d+)$`)
+
 func NewConfig() *Config {
-	return &Config{Image: ImageConfig{Name: "ghcr.io/omnigres/omnigres-17"}}
+	return &Config{Image: ImageConfig{Name: PostgresImage(DefaultPostgresVersion)}}
+}
+
+// WithPostgresVersion returns a copy of the configuration that uses the
+// Omnigres image for the major Postgres version. The copy has no volume, as
+// the workspace's data is bound to the workspace's Postgres version.
+func (c *Config) WithPostgresVersion(version int) *Config {
+	cfg := *c
+	cfg.Volume = ""
+	if c.Image.Build != nil {
+		build := *c.Image.Build
+		cfg.Image.Build = &build
+	}
+	cfg.PostgresVersion = version
+	cfg.applyPostgresVersion()
+	return &cfg
+}
+
+// applyPostgresVersion makes the configured image (or the base of the
+// custom image) follow the configured Postgres version
+func (c *Config) applyPostgresVersion() {
+	if c.PostgresVersion == 0 {
+		return
+	}
+	image := PostgresImage(c.PostgresVersion)
+	if build := c.Image.Build; build != nil {
+		if ImageRepository(build.Base) != image {
+			build.Base = image
+		}
+		return
+	}
+	if ImageRepository(c.Image.Name) != image {
+		c.Image.Name = image
+		c.Image.Digest = ""
+	}
+}
+
+// FollowImage keeps the configured Postgres version in line with an image
+// chosen explicitly (e.g. by pinning it), clearing the version if the image
+// is not an Omnigres image. Otherwise the version would select its own image
+// again when the configuration is loaded.
+func (c *Config) FollowImage(image string) {
+	if c.PostgresVersion == 0 || c.Image.Build != nil {
+		return
+	}
+	version, ok := PostgresVersionOf(image)
+	if !ok {
+		version = 0
+	}
+	c.PostgresVersion = version
+}
+
+// NewWorkspaceID returns a random workspace identifier
+func NewWorkspaceID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Orb returns the configuration of the orb with the given name
+func (c *Config) Orb(name string) (orb OrbCfg, ok bool) {
+	for _, o := range c.Orbs {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	return
 }
 
 func (c *Config) Save() (err error) {
 	if c.path != "" {
-		c.SaveAs(c.path)
+		err = c.SaveAs(c.path)
 	} else {
 		err = errors.New("Config has no path")
 	}
 	return
 }
+
+// newConfigViper returns a viper instance whose keys are not split on dots,
+// as they appear in Postgres parameter names (e.g. cron.database_name)
+func newConfigViper() *viper.Viper {
+	return viper.NewWithOptions(viper.KeyDelimiter("::"))
+}
+
 func (c *Config) SaveAs(path string) (err error) {
-	v := viper.New()
+	v := newConfigViper()
 	v.SetConfigName("omnigres")
 	v.SetConfigType("yaml")
 	v.AddConfigPath(path)
 
+	if c.ID != "" {
+		v.Set("id", c.ID)
+	}
 	v.Set("orbs", c.Orbs)
 	v.Set("image", c.Image)
+	if c.PostgresVersion != 0 {
+		v.Set("postgres_version", c.PostgresVersion)
+	}
+	if c.Resources != (Resources{}) {
+		v.Set("resources", c.Resources)
+	}
+	if len(c.Postgres) > 0 {
+		v.Set("postgres", c.Postgres)
+	}
+	if len(c.Env) > 0 {
+		v.Set("env", c.Env)
+	}
+	if len(c.Secrets) > 0 {
+		v.Set("secrets", c.Secrets)
+	}
+	if c.Volume != "" {
+		v.Set("volume", c.Volume)
+	}
 
 	err = fileutils.CreateIfNotExists(filepath.Join(path, "omnigres.yaml"), false)
 	if err != nil {
@@ -59,7 +275,7 @@ func (c *Config) SaveAs(path string) (err error) {
 }
 
 func LoadConfig(path string) (cfg *Config, err error) {
-	v := viper.New()
+	v := newConfigViper()
 	configPath := filepath.Join(path, "omnigres.yaml")
 	log.Debug("Loading config", "path", configPath)
 	v.SetConfigFile(configPath)
@@ -80,5 +296,11 @@ func LoadConfig(path string) (cfg *Config, err error) {
 	if err != nil {
 		return
 	}
+	if version, ok := PostgresVersionOf(cfg.Image.Name); ok && cfg.Image.Build == nil &&
+		cfg.PostgresVersion != 0 && version != cfg.PostgresVersion {
+		log.Warnf("Image %s does not match postgres_version %d, using %s",
+			cfg.Image.Name, cfg.PostgresVersion, PostgresImage(cfg.PostgresVersion))
+	}
+	cfg.applyPostgresVersion()
 	return
 }
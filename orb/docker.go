@@ -1,6 +1,7 @@
 package orb
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
@@ -10,29 +11,39 @@ import (
 	"os"
 	"os/signal"
 	"os/user"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/errdefs"
-	_ "github.com/lib/pq"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/lib/pq"
 	"github.com/omnigres/cli/internal/fileutils"
-	"github.com/omnigres/cli/tui"
 	"github.com/spf13/viper"
 	"golang.org/x/term"
 )
 
 const default_directory_mount = "/mnt/host"
 
+// data_mount is where the persistent volume is mounted, it contains PGDATA
+const data_mount = "/var/lib/postgresql"
+
+// orbs_mount is where orbs with their own path are mounted, each in a directory named after the orb
+const orbs_mount = "/mnt/orbs"
+
 type DockerOrbCluster struct {
 	client             *client.Client
 	currentContainerId string
+	// replacing is set while the container is being replaced, so that the
+	// old one is not found by its labels
+	replacing bool
 	OrbOptions
 }
 
@@ -69,10 +80,80 @@ func (d *DockerOrbCluster) Configure(options OrbOptions) error {
 	return nil
 }
 
+func (d *DockerOrbCluster) OrbPath(name string) string {
+	if orb, ok := d.Config().Orb(name); ok && orb.Path != "" {
+		return path.Join(orbs_mount, name)
+	}
+	return path.Join(default_directory_mount, name)
+}
+
+// mounts returns the mounts of the cluster's container. Only the persistent
+// cluster keeps its data in the configured volume, ephemeral ones (run, test)
+// must never touch it.
+func (d *DockerOrbCluster) mounts(persistent bool) (mounts []mount.Mount, err error) {
+	mounts = []mount.Mount{
+		{
+			Type:   mount.TypeBind,
+			Source: d.Path,
+			Target: default_directory_mount,
+		},
+	}
+	var orbMounts []mount.Mount
+	orbMounts, err = d.orbMounts()
+	if err != nil {
+		return
+	}
+	mounts = append(mounts, orbMounts...)
+	if volume := d.Config().Volume; volume != "" && persistent {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: volume,
+			Target: data_mount,
+		})
+	}
+	return
+}
+
+// orbMounts returns bind mounts for orbs that live outside of the workspace directory
+func (d *DockerOrbCluster) orbMounts() (mounts []mount.Mount, err error) {
+	for _, orb := range d.Config().Orbs {
+		if orb.Path == "" {
+			continue
+		}
+		source := orb.HostPath(d.Path)
+		source, err = filepath.Abs(source)
+		if err != nil {
+			return
+		}
+		if _, err = os.Stat(source); err != nil {
+			err = fmt.Errorf("path of orb %s is not accessible: %w", orb.Name, err)
+			return
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: source,
+			Target: d.OrbPath(orb.Name),
+		})
+	}
+	return
+}
+
 func (d *DockerOrbCluster) prepareImage(ctx context.Context) (digest string, err error) {
 	cli := d.client
+
+	// Custom images are (re)built whenever their inputs change
+	if d.Config().Image.Build != nil {
+		digest, err = d.BuildImage(ctx, false)
+		return
+	}
+
 	imageName := d.Config().Image.Name
 
+	// A pinned digest takes precedence over the tag
+	if d.Config().Image.Digest != "" {
+		imageName = d.Config().Image.Digest
+	}
+
 	var img types.ImageInspect
 
 	// Try getting the image locally
@@ -85,53 +166,18 @@ func (d *DockerOrbCluster) prepareImage(ctx context.Context) (digest string, err
 		return
 	}
 
-	digest = imageName
-
-	if !notFound {
-		// Get the digest (if found)
-		if len(img.RepoDigests) > 0 {
-			digest = img.RepoDigests[0]
-
-			// If digest does not match, it is as good as if was not found
-			if d.Config().Image.Digest != "" && d.Config().Image.Digest != digest {
-				imageName = digest
-				notFound = true
-			}
-		}
-	}
-
 	if notFound {
-		// Pull the image
-		var reader io.ReadCloser
-		reader, err = cli.ImagePull(ctx, imageName, image.PullOptions{})
-		if err != nil {
-			return
-		}
-		defer reader.Close()
-
-		progress := tui.NewDownloadProgress("Downloading docker image "+imageName, reader)
-		progressModel, progressError := progress.Run()
-		if progressError != nil {
-			fmt.Println("Download failed to run for image", imageName, progressError.Error())
-			os.Exit(1)
-		}
-
-		m := progressModel.(tui.Model)
-		if m.Err != nil {
-			fmt.Println("Oh no! Could not download image", imageName)
-			os.Exit(1)
-		}
-
-		// Getting the image locally again to get the digest
-		img, _, err = cli.ImageInspectWithRaw(ctx, imageName)
+		digest, err = d.PullImage(ctx, imageName)
 		if err != nil {
 			return
 		}
+	} else {
+		digest = repoDigest(img, imageName)
+	}
 
-		// Fetch the digest
-		if len(img.RepoDigests) > 0 {
-			digest = img.RepoDigests[0]
-		}
+	if digest == "" {
+		// Locally built images have no repository digest
+		digest = imageName
 	}
 
 	// Ensure the config has been updated
@@ -149,47 +195,6 @@ func (d *DockerOrbCluster) runfile() (v *viper.Viper) {
 	return
 }
 
-func (d *DockerOrbCluster) waitUntilClusterIsReady(ctx context.Context, listeners []OrbStartEventListener, cancel context.CancelFunc) {
-
-	log.Debug("Waiting for is_omnigres_ready...")
-	deadline := time.Now().Add(1 * time.Minute)
-
-	ready := false
-
-checkPg:
-	for time.Now().Before(deadline) {
-		c, err := d.Connect(ctx)
-		if err == nil {
-			if err = c.Ping(); err != nil {
-				continue checkPg
-			}
-		checkOmnigres:
-			for time.Now().Before(deadline) {
-				if err = c.QueryRowContext(ctx, "select is_omnigres_ready()").Scan(&ready); err != nil {
-					time.Sleep(1 * time.Second)
-					log.Debugf("Error trying is_omnigres_ready: %s", err)
-					continue checkOmnigres
-				}
-				_ = c.Close()
-				log.Debugf("is_omnigres_ready: %t", ready)
-				if ready {
-					for _, listener := range listeners {
-						if listener.Ready != nil {
-							go listener.Ready(d)
-						}
-					}
-					return
-				}
-				time.Sleep(1 * time.Second)
-			}
-		}
-		time.Sleep(1 * time.Second)
-	}
-
-	fmt.Println("Can't get a healthy cluster, terminating...")
-	cancel()
-}
-
 func (d *DockerOrbCluster) StartWithCurrentUser(ctx context.Context, options OrbClusterStartOptions) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -198,7 +203,8 @@ func (d *DockerOrbCluster) StartWithCurrentUser(ctx context.Context, options Orb
 	var currentUser *user.User
 	currentUser, err = user.Current()
 	if err != nil {
-		log.Fatalf("Could not get current user: %s", err)
+		err = fmt.Errorf("could not get current user: %w", err)
+		return
 	}
 
 	err = d.Start(
@@ -207,9 +213,6 @@ func (d *DockerOrbCluster) StartWithCurrentUser(ctx context.Context, options Orb
 		&currentUser.Uid,
 		nil,
 	)
-	if err != nil {
-		log.Fatal("Fail starting Orb", "err", err)
-	}
 	return
 }
 
@@ -224,6 +227,11 @@ func (d *DockerOrbCluster) Start(ctx context.Context, options OrbClusterStartOpt
 	var containerId string
 
 	if options.Runfile {
+		// Identify the workspace so that its container can be found by labels
+		if d.Config().ID == "" {
+			d.Config().ID = NewWorkspaceID()
+		}
+
 		run = d.runfile()
 		err = fileutils.CreateIfNotExists(run.ConfigFileUsed(), false)
 		if err != nil {
@@ -269,48 +277,55 @@ checkContainer:
 		if err != nil {
 			return
 		}
-		if len(image.RepoDigests) > 0 && image.RepoDigests[0] != imageDigest {
-			err = fmt.Errorf("Container's image %s does not match expected %s", image.RepoDigests[0], imageDigest)
+		if containerDigest := repoDigest(image, imageDigest); containerDigest != "" && containerDigest != imageDigest {
+			err = fmt.Errorf("Container's image %s does not match expected %s", containerDigest, imageDigest)
 			return
 		}
 
-	} else {
+		err = d.updateResources(ctx, cnt)
+		if err != nil {
+			return
+		}
 
-		networkName := "omnigres"
+		// The container's network may have been removed since it was created
+		if cnt.HostConfig.NetworkMode.IsUserDefined() {
+			err = d.ensureNetwork(ctx, cnt.HostConfig.NetworkMode.NetworkName())
+			if err != nil {
+				return
+			}
+		}
 
-		_, err = cli.NetworkCreate(ctx, networkName, network.CreateOptions{
-			Driver: "bridge",
-		})
+	} else {
 
+		networkName := d.networkName()
+		err = d.ensureNetwork(ctx, networkName)
 		if err != nil {
-			// If it is a conflict, this is normal flow – network already exists
-			if !errdefs.IsConflict(err) {
-				// otherwise, it's an error
-				return
-			}
+			return
 		}
 
 		// Bindings
 		hostconfig := container.HostConfig{
-			AutoRemove: options.AutoRemove,
-			Mounts: []mount.Mount{
-				{
-					Type:   mount.TypeBind,
-					Source: d.Path,
-					Target: default_directory_mount,
-				},
-			},
+			AutoRemove:  options.AutoRemove,
 			NetworkMode: container.NetworkMode(networkName),
 		}
+		hostconfig.Mounts, err = d.mounts(options.Runfile)
+		if err != nil {
+			return
+		}
+		hostconfig.Resources, hostconfig.ShmSize, err = d.Config().Resources.hostResources()
+		if err != nil {
+			return
+		}
 
 		// Prepare environment for every orb
+		var orbEnv []EnvVar
+		orbEnv, err = d.Environment()
+		if err != nil {
+			return
+		}
 		env := make([]string, 0)
-		for _, orb := range d.Config().Orbs {
-			for _, e := range os.Environ() {
-				if strings.HasPrefix(e, strings.ToUpper(orb.Name+"_")) {
-					env = append(env, e)
-				}
-			}
+		for _, e := range orbEnv {
+			env = append(env, e.String())
 		}
 		env = append(env, "POSTGRES_HOST_AUTH_METHOD=password")
 		// Allows to prevent problems with initialization scripts failing due to
@@ -322,7 +337,19 @@ checkContainer:
 		log.Debugf("Creating container ...")
 		var containerResponse container.CreateResponse
 		var config *container.Config
-		config = &container.Config{Image: imageDigest, Env: env}
+		config = &container.Config{
+			Image:  imageDigest,
+			Env:    env,
+			Labels: d.labels(!options.Runfile),
+		}
+		config.Cmd, err = d.postgresCommand(ctx, imageDigest)
+		if err != nil {
+			return
+		}
+		config.Labels[envHashLabel], err = d.environmentHash()
+		if err != nil {
+			return
+		}
 		if runAs != nil {
 			log.Debugf("🪪 Starting cluster with current user id: %s", *runAs)
 			// Ensure we have the right user and group
@@ -332,14 +359,24 @@ checkContainer:
 			log.Debugf("🛂 Starting cluster with custom entry point: %s", entryPoint)
 			config.Entrypoint = entryPoint
 		}
+		// Persistent clusters are named after the workspace, ephemeral ones get random names
+		name := ""
+		if options.Runfile {
+			name = d.containerName()
+		}
 		containerResponse, err = cli.ContainerCreate(
 			ctx,
 			config,
 			&hostconfig,
 			nil,
 			nil,
-			"",
+			name,
 		)
+		for attempt := 0; errdefs.IsConflict(err) && name != "" && attempt < containerNameAttempts; attempt++ {
+			name = d.uniqueContainerName(attempt)
+			log.Debug("Container name is taken, using a unique one", "name", name)
+			containerResponse, err = cli.ContainerCreate(ctx, config, &hostconfig, nil, nil, name)
+		}
 		if err != nil {
 			return
 		}
@@ -382,6 +419,11 @@ checkContainer:
 			go listener.Started(d)
 		}
 	}
+	for _, listener := range options.Listeners {
+		if listener.Stage != nil {
+			listener.Stage(d, StageContainerUp)
+		}
+	}
 
 	// If we fail below, stop the container
 	defer func() {
@@ -412,10 +454,12 @@ checkContainer:
 		}
 	}
 
-	// TODO: do this in the background?
 	// wait only when we have Listeners
-	if options.Listeners != nil {
-		d.waitUntilClusterIsReady(ctx, options.Listeners, cancel)
+	if options.Listeners != nil && !options.NoWait {
+		err = d.waitUntilClusterIsReady(ctx, options)
+		if err != nil {
+			return
+		}
 	}
 
 	if options.Attachment.ShouldAttach {
@@ -440,17 +484,38 @@ checkContainer:
 	return nil
 }
 
+// ensureNetwork creates the network, unless it exists
+func (d *DockerOrbCluster) ensureNetwork(ctx context.Context, name string) (err error) {
+	_, err = d.client.NetworkCreate(ctx, name, network.CreateOptions{
+		Driver: "bridge",
+	})
+	// If it is a conflict, this is normal flow – network already exists
+	if errdefs.IsConflict(err) {
+		err = nil
+	}
+	return
+}
+
 func (d *DockerOrbCluster) containerId() (containerId string, err error) {
 	if d.currentContainerId != "" {
 		containerId = d.currentContainerId
 	} else {
 		v := d.runfile()
 		err = v.ReadInConfig()
-		if err != nil {
-			return
+		if err == nil {
+			containerId = v.GetString("containerid")
+		}
+		if containerId == "" && (err == nil || errors.Is(err, os.ErrNotExist)) && !d.replacing {
+			// Without a runfile, look the container up by the workspace's labels
+			id, lookupErr := d.findContainer(context.Background())
+			if lookupErr != nil {
+				log.Debug("Could not look up the container by labels", "err", lookupErr)
+			}
+			if id != "" {
+				log.Warn("Runfile is missing, found the cluster's container by its labels, 'omnigres repair' will restore the runfile", "container", id)
+				containerId, err = id, nil
+			}
 		}
-
-		containerId = v.GetString("containerid")
 	}
 	return
 }
@@ -482,6 +547,32 @@ func (d *DockerOrbCluster) Stop(ctx context.Context) (err error) {
 	return
 }
 
+func (d *DockerOrbCluster) Remove(ctx context.Context) (err error) {
+	var id string
+	id, err = d.containerId()
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing to forget about
+		return nil
+	}
+	if err != nil {
+		return
+	}
+
+	if id != "" {
+		err = d.client.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+		if err != nil && !errdefs.IsNotFound(err) {
+			return
+		}
+	}
+	d.currentContainerId = ""
+
+	err = os.Remove(d.runfile().ConfigFileUsed())
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
 func (d *DockerOrbCluster) Close() (err error) {
 	err = d.client.Close()
 	return
@@ -549,6 +640,70 @@ func (d *DockerOrbCluster) ConnectPsql(ctx context.Context, database ...string)
 	return
 }
 
+// exec runs cmd inside the cluster container, feeding it stdin (if any) and
+// copying its standard output to stdout. Standard error is collected and
+// reported if the command fails.
+func (d *DockerOrbCluster) exec(ctx context.Context, cmd []string, stdin io.Reader, stdout io.Writer) (err error) {
+	var id string
+	id, err = d.containerId()
+	if err != nil {
+		return
+	}
+	cli := d.client
+
+	var execResponse types.IDResponse
+	execResponse, err = cli.ContainerExecCreate(ctx, id, container.ExecOptions{
+		Cmd:          cmd,
+		WorkingDir:   default_directory_mount,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return
+	}
+
+	var resp types.HijackedResponse
+	resp, err = cli.ContainerExecAttach(ctx, execResponse.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return
+	}
+	defer resp.Close()
+
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(resp.Conn, stdin)
+			_ = resp.CloseWrite()
+		}()
+	}
+
+	var stderr bytes.Buffer
+	_, err = stdcopy.StdCopy(stdout, &stderr, resp.Reader)
+	if err != nil {
+		return
+	}
+
+	var inspect container.ExecInspect
+	inspect, err = cli.ContainerExecInspect(ctx, execResponse.ID)
+	if err != nil {
+		return
+	}
+	if inspect.ExitCode != 0 {
+		err = fmt.Errorf("%s exited with code %d: %s", cmd[0], inspect.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+	return
+}
+
+// Dump writes a plain SQL dump of the database to w
+func (d *DockerOrbCluster) Dump(ctx context.Context, database string, w io.Writer) error {
+	return d.exec(ctx, []string{"pg_dump", "-Uomnigres", database}, nil, w)
+}
+
+// Restore runs a plain SQL dump read from r in the database, stopping at the first error
+func (d *DockerOrbCluster) Restore(ctx context.Context, database string, r io.Reader) error {
+	return d.exec(ctx, []string{"psql", "-Uomnigres", "-q", "-v", "ON_ERROR_STOP=1", "-d", database}, r, io.Discard)
+}
+
 func (d *DockerOrbCluster) NetworkID(ctx context.Context) (network string, err error) {
 	cli := d.client
 
@@ -610,10 +765,30 @@ func (d *DockerOrbCluster) Connect(ctx context.Context, database ...string) (con
 		return
 	}
 	port := 5432
-	conn, err = sql.Open("postgres", fmt.Sprintf("user=omnigres password=omnigres dbname=%s host=%s port=%d sslmode=disable", db, ip, port))
+	var connector *pq.Connector
+	connector, err = pq.NewConnector(fmt.Sprintf("user=omnigres password=omnigres dbname=%s host=%s port=%d sslmode=disable", db, ip, port))
+	if err != nil {
+		return
+	}
+	connector.Dialer(&clusterDialer{net.Dialer{Timeout: dialTimeout}})
+	conn = sql.OpenDB(connector)
 	return
 }
 
+// dialTimeout limits connecting to a cluster's container, whose IP may be unreachable from the host
+const dialTimeout = 5 * time.Second
+
+// clusterDialer dials with the context of the query when there is one
+type clusterDialer struct {
+	net.Dialer
+}
+
+func (c *clusterDialer) DialTimeout(network string, address string, timeout time.Duration) (net.Conn, error) {
+	dialer := c.Dialer
+	dialer.Timeout = timeout
+	return dialer.Dial(network, address)
+}
+
 func (d *DockerOrbCluster) Endpoints(ctx context.Context) (endpoints []Endpoint, err error) {
 	var addr string
 	addr, err = d.NetworkIP(ctx)
@@ -0,0 +1,54 @@
+package orb
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+)
+
+// Down removes the cluster's container and runfile, and the workspace's
+// network if no other cluster (such as an ephemeral one) uses it. With
+// volumes, the data volume is removed as well.
+func (d *DockerOrbCluster) Down(ctx context.Context, volumes bool) (err error) {
+	cli := d.client
+
+	err = d.Remove(ctx)
+	if err != nil {
+		return
+	}
+
+	// Stopped containers keep their network, too, but only running ones are
+	// listed when inspecting it
+	networkName := d.networkName()
+	var attached []types.Container
+	attached, err = cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("network", networkName)),
+	})
+	if err != nil {
+		return
+	}
+	if len(attached) > 0 {
+		log.Debug("Network is used by other clusters", "network", networkName, "containers", len(attached))
+	} else {
+		log.Info("Removing network", "network", networkName)
+		err = cli.NetworkRemove(ctx, networkName)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return
+		}
+		err = nil
+	}
+
+	if volume := d.Config().Volume; volumes && volume != "" {
+		log.Info("Removing volume", "volume", volume)
+		err = cli.VolumeRemove(ctx, volume, false)
+		if errdefs.IsNotFound(err) {
+			err = nil
+		}
+	}
+	return
+}
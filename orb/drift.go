@@ -0,0 +1,131 @@
+package orb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-units"
+)
+
+// Drift is a difference between the cluster's container and the one the
+// configuration would create
+type Drift struct {
+	// Aspect is what differs: image, env, mounts, shm_size or postgres
+	Aspect    string
+	Container string
+	Config    string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: container has %s, configuration wants %s", d.Aspect, d.Container, d.Config)
+}
+
+// Drift compares the cluster's container with the configuration. Memory and
+// CPU limits are not considered, as they are updated in place when the
+// cluster starts.
+func (d *DockerOrbCluster) Drift(ctx context.Context) (drift []Drift, err error) {
+	var id string
+	id, err = d.containerId()
+	if errors.Is(err, os.ErrNotExist) || (err == nil && id == "") {
+		// No container yet
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var cnt types.ContainerJSON
+	cnt, err = d.client.ContainerInspect(ctx, id)
+	if errdefs.IsNotFound(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	// Image
+	var image string
+	if d.Config().Image.Build != nil {
+		_, image, err = d.imageBuild(ctx, false)
+		if err != nil {
+			return
+		}
+	} else {
+		image = d.Config().Image.Name
+		if d.Config().Image.Digest != "" {
+			image = d.Config().Image.Digest
+		}
+	}
+	var img types.ImageInspect
+	img, _, err = d.client.ImageInspectWithRaw(ctx, image)
+	switch {
+	case errdefs.IsNotFound(err):
+		drift = append(drift, Drift{"image", cnt.Config.Image, image + " (not available locally)"})
+	case err != nil:
+		return
+	case img.ID != cnt.Image:
+		drift = append(drift, Drift{"image", cnt.Config.Image, image})
+	}
+	err = nil
+
+	// Environment
+	var changed bool
+	changed, err = d.EnvironmentChanged(ctx)
+	if err != nil {
+		return
+	}
+	if changed {
+		drift = append(drift, Drift{"env", "the environment it was created with", "a different one (see 'omnigres env')"})
+	}
+
+	// Mounts
+	var mounts []mount.Mount
+	mounts, err = d.mounts(true)
+	if err != nil {
+		return
+	}
+	if want, have := describeMounts(mounts), describeMounts(cnt.HostConfig.Mounts); want != have {
+		drift = append(drift, Drift{"mounts", have, want})
+	}
+
+	// Postgres parameters are given on the command line
+	var cmd []string
+	cmd, err = d.postgresCommand(ctx, cnt.Image)
+	if err != nil {
+		return
+	}
+	if !slices.Equal(cmd, cnt.Config.Cmd) {
+		drift = append(drift, Drift{"postgres", strings.Join(cnt.Config.Cmd, " "), strings.Join(cmd, " ")})
+	}
+
+	// Shared memory can't be updated in place
+	var shmSize int64
+	_, shmSize, err = d.Config().Resources.hostResources()
+	if err != nil {
+		return
+	}
+	if shmSize != 0 && shmSize != cnt.HostConfig.ShmSize {
+		drift = append(drift, Drift{"shm_size", units.BytesSize(float64(cnt.HostConfig.ShmSize)), units.BytesSize(float64(shmSize))})
+	}
+	return
+}
+
+func describeMounts(mounts []mount.Mount) string {
+	descriptions := make([]string, 0, len(mounts))
+	for _, m := range mounts {
+		descriptions = append(descriptions, fmt.Sprintf("%s:%s", m.Source, m.Target))
+	}
+	slices.Sort(descriptions)
+	if len(descriptions) == 0 {
+		return "no mounts"
+	}
+	return strings.Join(descriptions, ", ")
+}
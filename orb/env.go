@@ -0,0 +1,206 @@
+package orb
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+)
+
+// EnvVar is a variable of the cluster's environment
+type EnvVar struct {
+	Name  string
+	Value string
+	// Source describes where the value comes from
+	Source string
+	Secret bool
+}
+
+func (e EnvVar) String() string {
+	return e.Name + "=" + e.Value
+}
+
+// Environment returns the environment of the cluster's container, from the
+// lowest to the highest precedence:
+//
+//   - .env of the workspace and .env of every orb
+//   - env of omnigres.yaml and of every orb
+//   - secrets of omnigres.yaml and of every orb
+//   - host variables prefixed with the orb name (<ORB>_)
+//
+// Orb variables are prefixed with the orb name. Names are upper-cased.
+func (d *DockerOrbCluster) Environment() (env []EnvVar, err error) {
+	vars := make(map[string]EnvVar)
+	set := func(prefix string, values map[string]string, source string, secret bool) {
+		for name, value := range values {
+			name = strings.ToUpper(prefix + name)
+			vars[name] = EnvVar{Name: name, Value: value, Source: source, Secret: secret}
+		}
+	}
+	orbPrefix := func(orb OrbCfg) string {
+		return strings.ToUpper(orb.Name + "_")
+	}
+
+	// .env files
+	var values map[string]string
+	values, err = readEnvFile(filepath.Join(d.Path, ".env"))
+	if err != nil {
+		return
+	}
+	set("", values, ".env", false)
+	for _, orb := range d.Config().Orbs {
+		file := filepath.Join(orb.HostPath(d.Path), ".env")
+		values, err = readEnvFile(file)
+		if err != nil {
+			return
+		}
+		set(orbPrefix(orb), values, filepath.Join(orb.Name, ".env"), false)
+	}
+
+	// omnigres.yaml
+	set("", d.Config().Env, "omnigres.yaml", false)
+	for _, orb := range d.Config().Orbs {
+		set(orbPrefix(orb), orb.Env, "omnigres.yaml", false)
+	}
+
+	// Secrets
+	readSecrets := func(prefix string, secrets map[string]string, dir string) (err error) {
+		for name, file := range secrets {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			var content []byte
+			content, err = os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("could not read secret %s: %w", name, err)
+			}
+			source := file
+			if rel, relErr := filepath.Rel(d.Path, file); relErr == nil && filepath.IsLocal(rel) {
+				source = rel
+			}
+			set(prefix, map[string]string{name: strings.TrimRight(string(content), "\r\n")}, source, true)
+		}
+		return
+	}
+	err = readSecrets("", d.Config().Secrets, d.Path)
+	if err != nil {
+		return
+	}
+	for _, orb := range d.Config().Orbs {
+		err = readSecrets(orbPrefix(orb), orb.Secrets, orb.HostPath(d.Path))
+		if err != nil {
+			return
+		}
+	}
+
+	// Host environment
+	for _, orb := range d.Config().Orbs {
+		for _, e := range os.Environ() {
+			if strings.HasPrefix(e, orbPrefix(orb)) {
+				name, value, _ := strings.Cut(e, "=")
+				vars[name] = EnvVar{Name: name, Value: value, Source: "host"}
+			}
+		}
+	}
+
+	for _, v := range vars {
+		env = append(env, v)
+	}
+	slices.SortFunc(env, func(a, b EnvVar) int { return strings.Compare(a.Name, b.Name) })
+	return
+}
+
+// environmentHash identifies the resolved environment, host variables
+// included, so that changing any of them is noticed
+func (d *DockerOrbCluster) environmentHash() (hash string, err error) {
+	var env []EnvVar
+	env, err = d.Environment()
+	if err != nil {
+		return
+	}
+	h := sha256.New()
+	for _, e := range env {
+		fmt.Fprintln(h, e.String())
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// EnvironmentChanged reports whether the environment has changed since the
+// cluster's container was created
+func (d *DockerOrbCluster) EnvironmentChanged(ctx context.Context) (changed bool, err error) {
+	var id string
+	id, err = d.containerId()
+	if errors.Is(err, os.ErrNotExist) || (err == nil && id == "") {
+		// No container yet
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var cnt types.ContainerJSON
+	cnt, err = d.client.ContainerInspect(ctx, id)
+	if errdefs.IsNotFound(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var current string
+	current, err = d.environmentHash()
+	if err != nil {
+		return
+	}
+	// Containers created before the environment was recorded are left alone
+	if hash, ok := cnt.Config.Labels[envHashLabel]; ok {
+		changed = hash != current
+	}
+	return
+}
+
+// readEnvFile reads NAME=value lines of a .env file, if it exists
+func readEnvFile(path string) (values map[string]string, err error) {
+	var file *os.File
+	file, err = os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	values = make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			err = fmt.Errorf("%s:%d: expected NAME=value", path, lineNo)
+			return
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(name)] = value
+	}
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,33 @@
+package orb
+
+import "strings"
+
+// Extension is a Postgres extension required by an orb, optionally pinned to
+// a specific version
+type Extension struct {
+	Name    string
+	Version string
+}
+
+// ParseExtension parses an extension specification in `name` or
+// `name@version` form
+func ParseExtension(spec string) Extension {
+	name, version, _ := strings.Cut(strings.TrimSpace(spec), "@")
+	return Extension{Name: name, Version: version}
+}
+
+func (e Extension) String() string {
+	if e.Version == "" {
+		return e.Name
+	}
+	return e.Name + "@" + e.Version
+}
+
+// RequiredExtensions returns the parsed list of the orb's extensions
+func (o OrbCfg) RequiredExtensions() (extensions []Extension) {
+	extensions = make([]Extension, 0, len(o.Extensions))
+	for _, spec := range o.Extensions {
+		extensions = append(extensions, ParseExtension(spec))
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package orb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/omnigres/cli/tui"
+)
+
+// ImageInfo describes an Omnigres image available locally
+type ImageInfo struct {
+	ID      string
+	Tags    []string
+	Digests []string
+	Created time.Time
+	Size    int64
+	// Containers is the number of containers using the image
+	Containers int64
+	// Workspace is true for images built for this workspace
+	Workspace bool
+}
+
+// isOmnigresImage returns true if any of the references is an Omnigres image
+func isOmnigresImage(references []string) bool {
+	for _, ref := range references {
+		repository := ImageRepository(ref)
+		if strings.HasPrefix(repository[strings.LastIndex(repository, "/")+1:], "omnigres-") {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageRepository strips the tag and the digest from an image reference
+func ImageRepository(reference string) string {
+	name, _, _ := strings.Cut(reference, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name
+}
+
+// repoDigest returns the image's digest in the repository of the given
+// image reference, falling back to the first known digest
+func repoDigest(img types.ImageInspect, reference string) string {
+	name := ImageRepository(reference)
+	for _, digest := range img.RepoDigests {
+		if strings.HasPrefix(digest, name+"@") {
+			return digest
+		}
+	}
+	if len(img.RepoDigests) > 0 {
+		return img.RepoDigests[0]
+	}
+	return ""
+}
+
+// PullImage pulls the image (tag or digest reference), reporting progress,
+// and returns its digest
+func (d *DockerOrbCluster) PullImage(ctx context.Context, name string) (digest string, err error) {
+	cli := d.client
+
+	var reader io.ReadCloser
+	reader, err = cli.ImagePull(ctx, name, image.PullOptions{})
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	err = tui.ShowDownloadProgress("Downloading docker image "+name, reader, d.Progress)
+	if err != nil {
+		err = fmt.Errorf("could not download image %s: %w", name, err)
+		return
+	}
+
+	var img types.ImageInspect
+	img, _, err = cli.ImageInspectWithRaw(ctx, name)
+	if err != nil {
+		return
+	}
+	digest = repoDigest(img, name)
+	return
+}
+
+// ImageDigest returns the digest of a locally available image
+func (d *DockerOrbCluster) ImageDigest(ctx context.Context, name string) (digest string, err error) {
+	var img types.ImageInspect
+	img, _, err = d.client.ImageInspectWithRaw(ctx, name)
+	if err != nil {
+		return
+	}
+	digest = repoDigest(img, name)
+	return
+}
+
+// Images lists Omnigres images available locally
+func (d *DockerOrbCluster) Images(ctx context.Context) (images []ImageInfo, err error) {
+	var summaries []image.Summary
+	summaries, err = d.client.ImageList(ctx, image.ListOptions{ContainerCount: true})
+	if err != nil {
+		return
+	}
+	for _, summary := range summaries {
+		if !isOmnigresImage(append(summary.RepoTags, summary.RepoDigests...)) {
+			continue
+		}
+		images = append(images, ImageInfo{
+			ID:         summary.ID,
+			Tags:       summary.RepoTags,
+			Digests:    summary.RepoDigests,
+			Created:    time.Unix(summary.Created, 0),
+			Size:       summary.Size,
+			Containers: summary.Containers,
+			Workspace:  d.ownsLabels(summary.Labels),
+		})
+	}
+	return
+}
+
+// RemoveImage removes a local image
+func (d *DockerOrbCluster) RemoveImage(ctx context.Context, id string) (err error) {
+	_, err = d.client.ImageRemove(ctx, id, image.RemoveOptions{PruneChildren: true})
+	return
+}
@@ -0,0 +1,83 @@
+package orb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Labels of the containers and images created for a workspace
+const (
+	workspaceLabel   = "org.omnigres.workspace"
+	workspaceIDLabel = "org.omnigres.workspace-id"
+	projectLabel     = "org.omnigres.project"
+	ephemeralLabel   = "org.omnigres.ephemeral"
+	// envHashLabel records the environment the container was created with
+	envHashLabel = "org.omnigres.env-hash"
+)
+
+var invalidNameCharacters = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// project is the workspace's name, usable in container names and image tags
+func (d *DockerOrbCluster) project() string {
+	project := invalidNameCharacters.ReplaceAllString(strings.ToLower(filepath.Base(d.Path)), "-")
+	project = strings.Trim(project, "-._")
+	if project == "" {
+		project = "workspace"
+	}
+	return project
+}
+
+// containerName is the name of the workspace's persistent cluster
+func (d *DockerOrbCluster) containerName() string {
+	return "omnigres-" + d.project()
+}
+
+// networkName is the network of the workspace's clusters, separating them
+// from other workspaces' clusters
+func (d *DockerOrbCluster) networkName() string {
+	return "omnigres-" + d.project()
+}
+
+// containerNameAttempts limits unique names tried when container names are taken
+const containerNameAttempts = 10
+
+// uniqueContainerName is used when another workspace with the same name
+// already has a container named after it. Should that name be taken, too,
+// further attempts get a counter appended.
+func (d *DockerOrbCluster) uniqueContainerName(attempt int) string {
+	sum := sha256.Sum256([]byte(d.Path))
+	name := d.containerName() + "-" + hex.EncodeToString(sum[:])[:6]
+	if attempt > 0 {
+		name += "-" + strconv.Itoa(attempt+1)
+	}
+	return name
+}
+
+// labels of the cluster's container
+func (d *DockerOrbCluster) labels(ephemeral bool) map[string]string {
+	labels := map[string]string{
+		workspaceLabel: d.Path,
+		projectLabel:   d.project(),
+	}
+	if id := d.Config().ID; id != "" {
+		labels[workspaceIDLabel] = id
+	}
+	if ephemeral {
+		labels[ephemeralLabel] = "true"
+	}
+	return labels
+}
+
+// ownsLabels returns true if the labels mark a container or an image of this
+// workspace: with its identity or, if either has no identity, its path
+func (d *DockerOrbCluster) ownsLabels(labels map[string]string) bool {
+	workspaceID := d.Config().ID
+	if workspaceID != "" && labels[workspaceIDLabel] != "" {
+		return labels[workspaceIDLabel] == workspaceID
+	}
+	return labels[workspaceLabel] != "" && labels[workspaceLabel] == d.Path
+}
@@ -0,0 +1,162 @@
+package orb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Where the upgrade container finds the old cluster's data and binaries
+const (
+	pgUpgradeOldData     = "/mnt/old-data"
+	pgUpgradeOldBinaries = "/mnt/old-binaries"
+)
+
+// CanUpgradeInPlace reports whether the cluster's data can be moved to the
+// image with pg_upgrade. That requires the data to be in a volume and both
+// images to be Omnigres images, the new one of a newer major version.
+func (d *DockerOrbCluster) CanUpgradeInPlace(image string) bool {
+	cfg := d.Config()
+	if cfg.Volume == "" || cfg.Image.Build != nil {
+		return false
+	}
+	from, ok := PostgresVersionOf(cfg.Image.Name)
+	if !ok {
+		return false
+	}
+	to, ok := PostgresVersionOf(image)
+	return ok && to > from
+}
+
+// pgUpgrade upgrades the data in the old volume into the new one with
+// pg_upgrade, running as the user of the cluster's container.
+//
+// pg_upgrade needs the binaries of both versions. The old ones are copied
+// out of the old image into a temporary volume, keeping their paths so that
+// they find their libraries and shared files relative to themselves.
+func (d *DockerOrbCluster) pgUpgrade(ctx context.Context, from ImageConfig, to string, oldVolume string, newVolume string, user string) (err error) {
+	cli := d.client
+	fromVersion, _ := PostgresVersionOf(from.Name)
+	toVersion, _ := PostgresVersionOf(to)
+	fromImage := from.Name
+	if from.Digest != "" {
+		fromImage = from.Digest
+	}
+
+	for _, image := range []string{fromImage, to} {
+		_, _, err = cli.ImageInspectWithRaw(ctx, image)
+		if errdefs.IsNotFound(err) {
+			_, err = d.PullImage(ctx, image)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	binaries := newVolume + "-binaries"
+	_, err = cli.VolumeCreate(ctx, volume.CreateOptions{Name: binaries, Labels: d.labels(true)})
+	if err != nil {
+		return
+	}
+	defer func() {
+		if removeErr := cli.VolumeRemove(context.WithoutCancel(ctx), binaries, true); removeErr != nil {
+			log.Warn("Could not remove the temporary volume", "volume", binaries, "err", removeErr)
+		}
+	}()
+
+	log.Info("Copying Postgres binaries", "image", fromImage, "postgres", fromVersion)
+	err = d.runToCompletion(ctx, &container.Config{
+		Image:      fromImage,
+		Entrypoint: []string{"cp"},
+		Cmd: []string{"-a", "--parents",
+			fmt.Sprintf("/usr/lib/postgresql/%d", fromVersion),
+			fmt.Sprintf("/usr/share/postgresql/%d", fromVersion),
+			pgUpgradeOldBinaries},
+		Labels: d.labels(true),
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: binaries, Target: pgUpgradeOldBinaries}},
+	})
+	if err != nil {
+		return
+	}
+
+	// The new data directory is initialized the way the image's entrypoint
+	// initializes it, before pg_upgrade fills it
+	script := fmt.Sprintf(`set -e
+source docker-entrypoint.sh
+docker_setup_env
+docker_create_db_directories
+docker_init_database_dir
+pg_setup_hba_conf
+cd /tmp
+pg_upgrade --old-bindir=%[1]s/usr/lib/postgresql/%[2]d/bin --new-bindir=/usr/lib/postgresql/%[3]d/bin \
+  --old-datadir=%[4]s/omnigres --new-datadir="$PGDATA" --username="$POSTGRES_USER"
+`, pgUpgradeOldBinaries, fromVersion, toVersion, pgUpgradeOldData)
+
+	log.Info("Upgrading data with pg_upgrade", "from", oldVolume, "to", newVolume, "postgres", toVersion)
+	err = d.runToCompletion(ctx, &container.Config{
+		Image:      to,
+		User:       user,
+		Entrypoint: []string{"bash", "-c", script},
+		Env:        []string{"PGDATA=" + data_mount + "/omnigres", "POSTGRES_HOST_AUTH_METHOD=password"},
+		Labels:     d.labels(true),
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: oldVolume, Target: pgUpgradeOldData},
+			{Type: mount.TypeVolume, Source: newVolume, Target: data_mount},
+			{Type: mount.TypeVolume, Source: binaries, Target: pgUpgradeOldBinaries, VolumeOptions: &mount.VolumeOptions{NoCopy: true}},
+		},
+	})
+	return
+}
+
+// runToCompletion runs a one-off container and removes it once it exits,
+// failing with the end of its output if it exits with a non-zero code
+func (d *DockerOrbCluster) runToCompletion(ctx context.Context, config *container.Config, hostConfig *container.HostConfig) (err error) {
+	cli := d.client
+
+	var created container.CreateResponse
+	created, err = cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = cli.ContainerRemove(context.WithoutCancel(ctx), created.ID, container.RemoveOptions{Force: true})
+	}()
+
+	statusCh, errCh := cli.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	err = cli.ContainerStart(ctx, created.ID, container.StartOptions{})
+	if err != nil {
+		return
+	}
+
+	var status container.WaitResponse
+	select {
+	case err = <-errCh:
+		return
+	case status = <-statusCh:
+	}
+	if status.StatusCode == 0 {
+		return
+	}
+
+	var logs io.ReadCloser
+	logs, err = cli.ContainerLogs(ctx, created.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Tail: "20"})
+	if err != nil {
+		return
+	}
+	defer logs.Close()
+	var output bytes.Buffer
+	_, _ = stdcopy.StdCopy(&output, &output, logs)
+	err = fmt.Errorf("%s exited with code %d: %s", config.Entrypoint[0], status.StatusCode, strings.TrimSpace(output.String()))
+	return
+}
@@ -0,0 +1,60 @@
+package orb
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// ClusterInfo describes an Omnigres cluster found on the host
+type ClusterInfo struct {
+	ID        string
+	Name      string
+	Workspace string
+	Ephemeral bool
+	Running   bool
+	Status    string
+	Image     string
+	// Endpoints of running clusters
+	Endpoints []Endpoint
+}
+
+// endpointsTimeout limits looking up the endpoints of each cluster
+const endpointsTimeout = 10 * time.Second
+
+// Clusters lists clusters of all workspaces, using the labels of their containers
+func (d *DockerOrbCluster) Clusters(ctx context.Context) (clusters []ClusterInfo, err error) {
+	var containers []types.Container
+	containers, err = d.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", workspaceLabel)),
+	})
+	if err != nil {
+		return
+	}
+
+	for _, cnt := range containers {
+		info := ClusterInfo{
+			ID:        cnt.ID,
+			Name:      strings.TrimPrefix(strings.Join(cnt.Names, ", "), "/"),
+			Workspace: cnt.Labels[workspaceLabel],
+			Ephemeral: cnt.Labels[ephemeralLabel] == "true",
+			Running:   cnt.State == "running",
+			Status:    cnt.Status,
+			Image:     cnt.Image,
+		}
+		if info.Running {
+			cluster := &DockerOrbCluster{client: d.client, currentContainerId: cnt.ID}
+			// A cluster that is still starting up (or unreachable) has no endpoints yet
+			endpointsCtx, cancel := context.WithTimeout(ctx, endpointsTimeout)
+			info.Endpoints, _ = cluster.Endpoints(endpointsCtx)
+			cancel()
+		}
+		clusters = append(clusters, info)
+	}
+	return
+}
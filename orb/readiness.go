@@ -0,0 +1,190 @@
+package orb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// DefaultWaitTimeout is how long to wait for a cluster to become ready, unless configured otherwise
+const DefaultWaitTimeout = 1 * time.Minute
+
+// maxBackoff caps the delay between readiness checks
+const maxBackoff = 2 * time.Second
+
+// ReadinessStage is a step of a cluster becoming ready
+type ReadinessStage int
+
+const (
+	StageContainerUp ReadinessStage = iota
+	StagePostgresAccepting
+	StageOmnigresReady
+	// StageHTTPListening is only waited for if requested
+	StageHTTPListening
+)
+
+func (s ReadinessStage) String() string {
+	switch s {
+	case StageContainerUp:
+		return "container is up"
+	case StagePostgresAccepting:
+		return "Postgres is accepting connections"
+	case StageOmnigresReady:
+		return "Omnigres is ready"
+	case StageHTTPListening:
+		return "HTTP listeners are responding"
+	default:
+		return fmt.Sprintf("stage %d", int(s))
+	}
+}
+
+// ReadinessError is returned when the cluster does not become ready in time
+type ReadinessError struct {
+	// Stage that was not reached
+	Stage   ReadinessStage
+	Timeout time.Duration
+	// Err is the last error of the stage's check
+	Err error
+}
+
+func (e *ReadinessError) Error() string {
+	return fmt.Sprintf("cluster is not ready after %s, waiting until %s: %s", e.Timeout, e.Stage, e.Err)
+}
+
+func (e *ReadinessError) Unwrap() error {
+	return e.Err
+}
+
+// waitFor retries the check with backoff until it succeeds or the context is done
+func waitFor(ctx context.Context, stage ReadinessStage, check func(ctx context.Context) error) (err error) {
+	delay := 100 * time.Millisecond
+	for {
+		err = check(ctx)
+		if err == nil {
+			return
+		}
+		log.Debug("Waiting", "stage", stage, "err", err)
+		select {
+		case <-ctx.Done():
+			return &ReadinessError{Stage: stage, Err: err}
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// waitReady waits until Postgres accepts connections and is_omnigres_ready() is true,
+// reporting every stage reached
+func (d *DockerOrbCluster) waitReady(ctx context.Context, report func(stage ReadinessStage)) (err error) {
+	err = waitFor(ctx, StagePostgresAccepting, func(ctx context.Context) (err error) {
+		var c *sql.DB
+		c, err = d.Connect(ctx)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		return c.PingContext(ctx)
+	})
+	if err != nil {
+		return
+	}
+	report(StagePostgresAccepting)
+
+	err = waitFor(ctx, StageOmnigresReady, func(ctx context.Context) (err error) {
+		var c *sql.DB
+		c, err = d.Connect(ctx)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		ready := false
+		err = c.QueryRowContext(ctx, "select is_omnigres_ready()").Scan(&ready)
+		if err == nil && !ready {
+			err = errors.New("is_omnigres_ready() is false")
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	report(StageOmnigresReady)
+	return
+}
+
+// httpProbe is run inside the container with the port as its argument. It
+// sends a request and expects an HTTP response, without relying on the host
+// being able to reach the container's network or on tools in the image.
+const httpProbe = `exec 3<>"/dev/tcp/127.0.0.1/$1" && printf 'HEAD / HTTP/1.0\r\n\r\n' >&3 && read -r -n 4 reply <&3 && [ "$reply" = HTTP ]`
+
+// waitHTTPListeners waits until every HTTP listener of the cluster responds
+func (d *DockerOrbCluster) waitHTTPListeners(ctx context.Context) (err error) {
+	return waitFor(ctx, StageHTTPListening, func(ctx context.Context) (err error) {
+		var endpoints []Endpoint
+		endpoints, err = d.Endpoints(ctx)
+		if err != nil {
+			return
+		}
+		for _, endpoint := range endpoints {
+			if endpoint.Protocol != "HTTP" {
+				continue
+			}
+			err = d.exec(ctx, []string{"bash", "-c", httpProbe, "http-probe", strconv.Itoa(endpoint.Port)}, nil, io.Discard)
+			if err != nil {
+				return fmt.Errorf("port %d of %s: %w", endpoint.Port, endpoint.Database, err)
+			}
+		}
+		return
+	})
+}
+
+// waitUntilClusterIsReady waits for every readiness stage, reporting stages
+// to the listeners and calling their Ready once done
+func (d *DockerOrbCluster) waitUntilClusterIsReady(ctx context.Context, options OrbClusterStartOptions) (err error) {
+	timeout := options.WaitTimeout
+	if timeout == 0 {
+		timeout = DefaultWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := func(stage ReadinessStage) {
+		log.Debug("Readiness", "stage", stage)
+		for _, listener := range options.Listeners {
+			if listener.Stage != nil {
+				listener.Stage(d, stage)
+			}
+		}
+	}
+
+	defer func() {
+		var readinessErr *ReadinessError
+		if errors.As(err, &readinessErr) {
+			readinessErr.Timeout = timeout
+		}
+	}()
+
+	err = d.waitReady(ctx, report)
+	if err != nil {
+		return
+	}
+	if options.WaitHTTP {
+		err = d.waitHTTPListeners(ctx)
+		if err != nil {
+			return
+		}
+		report(StageHTTPListening)
+	}
+
+	for _, listener := range options.Listeners {
+		if listener.Ready != nil {
+			go listener.Ready(d)
+		}
+	}
+	return
+}
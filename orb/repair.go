@@ -0,0 +1,86 @@
+package orb
+
+import (
+	"context"
+	"errors"
+
+	"github.com/charmbracelet/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// findContainer looks up the workspace's persistent container by its labels.
+//
+// Containers labelled with both the workspace's identity and path are
+// preferred, then those with the same identity (the workspace was moved or
+// cloned again), then those with the same path. Running containers are
+// preferred over stopped ones.
+func (d *DockerOrbCluster) findContainer(ctx context.Context) (id string, err error) {
+	var containers []types.Container
+	containers, err = d.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", workspaceLabel)),
+	})
+	if err != nil {
+		return
+	}
+
+	workspaceID := d.Config().ID
+	best := 0
+	for _, cnt := range containers {
+		if cnt.Labels[ephemeralLabel] == "true" {
+			continue
+		}
+		sameID := workspaceID != "" && cnt.Labels[workspaceIDLabel] == workspaceID
+		samePath := cnt.Labels[workspaceLabel] == d.Path
+		score := 0
+		switch {
+		case sameID && samePath:
+			score = 6
+		case sameID:
+			score = 4
+		case samePath && (workspaceID == "" || cnt.Labels[workspaceIDLabel] == ""):
+			score = 2
+		default:
+			continue
+		}
+		if cnt.State == "running" {
+			score++
+		}
+		if score > best {
+			best, id = score, cnt.ID
+		}
+	}
+	return
+}
+
+// Repair finds the workspace's container by its labels and rewrites the runfile
+func (d *DockerOrbCluster) Repair(ctx context.Context) (id string, err error) {
+	id, err = d.findContainer(ctx)
+	if err != nil {
+		return
+	}
+	if id == "" {
+		err = errors.New("no container of this workspace found")
+		return
+	}
+
+	run := d.runfile()
+	var current string
+	if run.ReadInConfig() == nil {
+		current = run.GetString("containerid")
+	}
+	if current == id {
+		log.Info("Runfile is up to date", "container", id)
+		return
+	}
+
+	run.Set("containerid", id)
+	err = run.WriteConfig()
+	if err != nil {
+		return
+	}
+	d.currentContainerId = id
+	return
+}
@@ -0,0 +1,321 @@
+package orb
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/lib/pq"
+	"github.com/samber/lo"
+)
+
+// listParameters are parameters whose elements are quoted individually by
+// ALTER SYSTEM, so their values are split on commas
+var listParameters = []string{
+	"search_path",
+	"temp_tablespaces",
+	"shared_preload_libraries",
+	"session_preload_libraries",
+	"local_preload_libraries",
+	"unix_socket_directories",
+}
+
+// mergedParameters are list parameters whose configured elements are added
+// to those set by the image's postgresql.conf instead of replacing them, as
+// Omnigres itself has to be preloaded
+var mergedParameters = []string{
+	"shared_preload_libraries",
+}
+
+// mergeWithImageSetting adds elements of the value to the parameter's value
+// in configuration files other than postgresql.auto.conf or, if it's not
+// there, on the server's command line
+func mergeWithImageSetting(ctx context.Context, db *sql.DB, name string, value string) (merged string, err error) {
+	var base sql.NullString
+	err = db.QueryRowContext(ctx,
+		`select coalesce(
+    (select setting from pg_file_settings where sourcefile not like '%/postgresql.auto.conf' and name = $1 order by seqno desc limit 1),
+    (select setting from pg_settings where source = 'command line' and name = $1))`,
+		name).Scan(&base)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	merged = mergeSettingValues(base.String, value)
+	return
+}
+
+// mergeSettingValues adds the elements of a list parameter's value to the base value
+func mergeSettingValues(base string, value string) string {
+	elements := lo.Map(strings.Split(base+","+value, ","), func(v string, _ int) string {
+		return strings.Trim(strings.TrimSpace(v), `"'`)
+	})
+	return strings.Join(lo.Uniq(lo.Compact(elements)), ",")
+}
+
+// normalizeSetting makes values written by ALTER SYSTEM comparable to configured ones
+func normalizeSetting(value string) string {
+	return strings.NewReplacer(" ", "", `"`, "", "'", "").Replace(value)
+}
+
+// commandLineSetting finds the parameter's value among the server's options
+// (-c name=value, -cname=value or --name=value), the last one wins
+func commandLineSetting(cmd []string, name string) (value string, ok bool) {
+	for i, arg := range cmd {
+		var option string
+		switch {
+		case arg == "-c" && i+1 < len(cmd):
+			option = cmd[i+1]
+		case strings.HasPrefix(arg, "-c"):
+			option = arg[2:]
+		case strings.HasPrefix(arg, "--"):
+			option = arg[2:]
+		default:
+			continue
+		}
+		if k, v, found := strings.Cut(option, "="); found && strings.ReplaceAll(k, "-", "_") == name {
+			value, ok = v, true
+		}
+	}
+	return
+}
+
+// confFileSetting finds the parameter's value in a postgresql.conf file, the last one wins
+func confFileSetting(r io.Reader, name string) (value string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		k, v, found := strings.Cut(line, "=")
+		if !found {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			k, v = fields[0], fields[1]
+		}
+		if strings.TrimSpace(k) == name {
+			value = strings.Trim(strings.TrimSpace(v), `'"`)
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// imageConfSetting finds the parameter's value in the postgresql.conf
+// sample of the image, which initdb turns into postgresql.conf. It's read
+// from a container that is created for that, but never started.
+func (d *DockerOrbCluster) imageConfSetting(ctx context.Context, img types.ImageInspect, name string) (value string, err error) {
+	major, found := lo.Find(img.Config.Env, func(e string) bool { return strings.HasPrefix(e, "PG_MAJOR=") })
+	if !found {
+		return
+	}
+	sample := fmt.Sprintf("/usr/share/postgresql/%s/postgresql.conf.sample", strings.TrimPrefix(major, "PG_MAJOR="))
+
+	var created container.CreateResponse
+	created, err = d.client.ContainerCreate(ctx, &container.Config{Image: img.ID, Labels: d.labels(true)}, nil, nil, nil, "")
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = d.client.ContainerRemove(context.WithoutCancel(ctx), created.ID, container.RemoveOptions{Force: true})
+	}()
+
+	var reader io.ReadCloser
+	reader, _, err = d.client.CopyFromContainer(ctx, created.ID, sample)
+	if errdefs.IsNotFound(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	_, err = tr.Next()
+	if err != nil {
+		return
+	}
+	return confFileSetting(tr, name)
+}
+
+// postgresCommand returns the image's command with the configured Postgres
+// parameters appended as -c options, so that they are in effect as soon as
+// the cluster starts, including those that can only be set at server start
+func (d *DockerOrbCluster) postgresCommand(ctx context.Context, image string) (cmd []string, err error) {
+	var img types.ImageInspect
+	img, _, err = d.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return
+	}
+	cmd = []string{"postgres"}
+	if img.Config != nil && len(img.Config.Cmd) > 0 {
+		cmd = slices.Clone(img.Config.Cmd)
+	}
+
+	settings := d.Config().Postgres
+	names := lo.Keys(settings)
+	slices.Sort(names)
+	for _, name := range names {
+		value := settings[name]
+		if slices.Contains(mergedParameters, name) {
+			base, ok := commandLineSetting(cmd, name)
+			if !ok && img.Config != nil {
+				base, err = d.imageConfSetting(ctx, img, name)
+				if err != nil {
+					return
+				}
+			}
+			value = mergeSettingValues(base, value)
+		}
+		cmd = append(cmd, "-c", name+"="+value)
+	}
+	return
+}
+
+// applySettings writes changed Postgres parameters with ALTER SYSTEM and
+// reloads the configuration, restarting the container if any of them
+// requires it. Parameters given on the container's command line when it
+// was created can't be overridden this way, they take effect once the
+// container is recreated.
+func (d *DockerOrbCluster) applySettings(ctx context.Context, cnt types.ContainerJSON, waitTimeout time.Duration) (err error) {
+	settings := d.Config().Postgres
+	if len(settings) == 0 {
+		return
+	}
+
+	var db *sql.DB
+	db, err = d.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	names := lo.Keys(settings)
+	slices.Sort(names)
+
+	changed := false
+	var fixed []string
+	for _, name := range names {
+		value := settings[name]
+		if slices.Contains(mergedParameters, name) {
+			value, err = mergeWithImageSetting(ctx, db, name, value)
+			if err != nil {
+				return
+			}
+		}
+		if created, ok := commandLineSetting(cnt.Config.Cmd, name); ok {
+			if normalizeSetting(created) != normalizeSetting(value) {
+				fixed = append(fixed, name)
+			}
+			continue
+		}
+		var current sql.NullString
+		err = db.QueryRowContext(ctx,
+			`select setting from pg_file_settings where sourcefile like '%/postgresql.auto.conf' and name = $1 order by seqno desc limit 1`,
+			name).Scan(&current)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if current.Valid && normalizeSetting(current.String) == normalizeSetting(value) {
+			continue
+		}
+
+		values := []string{value}
+		if slices.Contains(listParameters, name) {
+			values = strings.Split(value, ",")
+		}
+		literals := lo.Map(values, func(v string, _ int) string { return pq.QuoteLiteral(strings.TrimSpace(v)) })
+
+		log.Info("Setting Postgres parameter", "name", name, "value", value)
+		_, err = db.ExecContext(ctx, fmt.Sprintf("alter system set %s = %s", pq.QuoteIdentifier(name), strings.Join(literals, ", ")))
+		if err != nil {
+			err = fmt.Errorf("could not set %s: %w", name, err)
+			return
+		}
+		changed = true
+	}
+	if len(fixed) > 0 {
+		log.Warn("Some Postgres parameters were set when the container was created, they take effect once it's recreated ('omnigres restart --recreate')",
+			"parameters", strings.Join(fixed, ", "))
+	}
+	if !changed {
+		return
+	}
+
+	_, err = db.ExecContext(ctx, "select pg_reload_conf()")
+	if err != nil {
+		return
+	}
+
+	var pendingRestart bool
+	err = db.QueryRowContext(ctx, "select exists(select from pg_settings where pending_restart)").Scan(&pendingRestart)
+	if err != nil || !pendingRestart {
+		return
+	}
+
+	log.Info("Restarting the cluster to apply Postgres parameters")
+	err = d.client.ContainerRestart(ctx, cnt.ID, container.StopOptions{})
+	if err != nil {
+		return
+	}
+	if waitTimeout == 0 {
+		waitTimeout = DefaultWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, waitTimeout)
+	defer cancel()
+	return d.waitReady(ctx, func(ReadinessStage) {})
+}
+
+// updateResources applies resource limits to an existing container
+func (d *DockerOrbCluster) updateResources(ctx context.Context, cnt types.ContainerJSON) (err error) {
+	var resources container.Resources
+	var shmSize int64
+	resources, shmSize, err = d.Config().Resources.hostResources()
+	if err != nil {
+		return
+	}
+	if shmSize != 0 && shmSize != cnt.HostConfig.ShmSize {
+		log.Warn("Changing shm_size requires recreating the container")
+	}
+	// Limits that are not configured are left as they are
+	if (resources.Memory == 0 || resources.Memory == cnt.HostConfig.Memory) &&
+		(resources.NanoCPUs == 0 || resources.NanoCPUs == cnt.HostConfig.NanoCPUs) {
+		return
+	}
+	log.Info("Updating container resources", "memory", d.Config().Resources.Memory, "cpus", d.Config().Resources.CPUs)
+	_, err = d.client.ContainerUpdate(ctx, cnt.ID, container.UpdateConfig{Resources: resources})
+	return
+}
+
+// Reload applies resources and Postgres parameters to the running cluster,
+// waiting up to waitTimeout (DefaultWaitTimeout if zero) should it have to be restarted
+func (d *DockerOrbCluster) Reload(ctx context.Context, waitTimeout time.Duration) (err error) {
+	var id string
+	id, err = d.containerId()
+	if err != nil {
+		return
+	}
+	var cnt types.ContainerJSON
+	cnt, err = d.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return
+	}
+	err = d.updateResources(ctx, cnt)
+	if err != nil {
+		return
+	}
+	return d.applySettings(ctx, cnt, waitTimeout)
+}
@@ -0,0 +1,143 @@
+package orb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+)
+
+// Upgrade replaces the cluster's container with a new one running the image.
+//
+// The old container is stopped, but kept until restore, called once the new
+// cluster is ready, succeeds. Otherwise, the new container is removed and the
+// old one is started again. If the data is kept in a volume, the new cluster
+// gets a new volume and the old one is kept. Without restore, the data is
+// upgraded into the new volume with pg_upgrade (see CanUpgradeInPlace).
+func (d *DockerOrbCluster) Upgrade(ctx context.Context, image string, restore func(cluster OrbCluster) error) (err error) {
+	cli := d.client
+	cfg := d.Config()
+
+	if restore == nil && !d.CanUpgradeInPlace(image) {
+		err = fmt.Errorf("the cluster can't be upgraded to %s in place", image)
+		return
+	}
+
+	var oldId string
+	oldId, err = d.containerId()
+	if err != nil {
+		return
+	}
+	var oldContainer types.ContainerJSON
+	oldContainer, err = cli.ContainerInspect(ctx, oldId)
+	if err != nil {
+		return
+	}
+	oldImage := cfg.Image
+	if oldImage.Build != nil {
+		build := *oldImage.Build
+		oldImage.Build = &build
+	}
+
+	log.Info("Stopping the current container", "container", oldId)
+	err = cli.ContainerStop(ctx, oldId, container.StopOptions{})
+	if err != nil {
+		return
+	}
+
+	// Custom images are rebuilt on top of the new image
+	if build := cfg.Image.Build; build != nil {
+		build.Base = image
+	} else {
+		cfg.Image = ImageConfig{Name: image}
+	}
+	// Data of the old cluster is kept in its volume, the new one gets a new volume
+	oldVolume := cfg.Volume
+	if oldVolume != "" {
+		cfg.Volume = upgradeVolumeName(oldVolume)
+		log.Info("Using a new volume", "volume", cfg.Volume)
+	}
+
+	newVolume := cfg.Volume
+	rollback := func(cause error) error {
+		log.Error("Upgrade failed, rolling back", "err", cause)
+		var errs []error
+		if d.currentContainerId != "" && d.currentContainerId != oldId {
+			errs = append(errs, cli.ContainerRemove(ctx, d.currentContainerId, container.RemoveOptions{Force: true}))
+		}
+		if newVolume != oldVolume {
+			err := cli.VolumeRemove(ctx, newVolume, true)
+			if err != nil && !errdefs.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+		}
+		cfg.Image = oldImage
+		cfg.Volume = oldVolume
+		d.currentContainerId = oldId
+		run := d.runfile()
+		run.Set("containerid", oldId)
+		errs = append(errs, run.WriteConfig())
+		errs = append(errs, cli.ContainerStart(ctx, oldId, container.StartOptions{}))
+		return errors.Join(append([]error{cause}, errs...)...)
+	}
+
+	// Forget the old container so that a new one is created
+	d.currentContainerId = ""
+	d.replacing = true
+	defer func() { d.replacing = false }()
+	run := d.runfile()
+	run.Set("containerid", "")
+	err = run.WriteConfig()
+	if err != nil {
+		return rollback(err)
+	}
+
+	if restore == nil {
+		err = d.pgUpgrade(ctx, oldImage, image, oldVolume, newVolume, oldContainer.Config.User)
+		if err != nil {
+			return rollback(err)
+		}
+	}
+
+	readyCh := make(chan OrbCluster, 1)
+	err = d.StartWithCurrentUser(ctx, OrbClusterStartOptions{Runfile: true, Listeners: []OrbStartEventListener{
+		{Ready: func(cluster OrbCluster) {
+			readyCh <- cluster
+		}}}})
+	if err != nil {
+		return rollback(err)
+	}
+
+	<-readyCh
+
+	if restore != nil {
+		err = restore(d)
+		if err != nil {
+			return rollback(err)
+		}
+	}
+
+	log.Info("Removing the old container", "container", oldId)
+	err = cli.ContainerRemove(ctx, oldId, container.RemoveOptions{Force: true})
+	if err != nil {
+		log.Warn("Could not remove the old container", "container", oldId, "err", err)
+		err = nil
+	}
+	if oldVolume != "" {
+		log.Info("The old data is kept in its volume", "volume", oldVolume)
+	}
+	return
+}
+
+var volumeGeneration = regexp.MustCompile(`-\d{14}$`)
+
+// upgradeVolumeName names the volume of an upgraded cluster after the current one
+func upgradeVolumeName(volume string) string {
+	return volumeGeneration.ReplaceAllString(volume, "") + "-" + time.Now().Format("20060102150405")
+}
@@ -0,0 +1,354 @@
+package src
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var archiveExtensions = []string{".tar.gz", ".tgz", ".zip"}
+
+// archiveClient downloads archives, giving up on servers that stall
+var archiveClient = &http.Client{Timeout: 5 * time.Minute}
+
+// maxArchiveSize limits the size of downloaded archives
+var maxArchiveSize int64 = 1 << 30
+
+func isHTTPURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// archiveExtension returns the archive extension of the input (local path or HTTP(S) URL),
+// or an empty string if it's not an archive
+func archiveExtension(input string) string {
+	name := input
+	if isHTTPURL(input) {
+		u, err := url.Parse(input)
+		if err != nil {
+			return ""
+		}
+		name = u.Path
+	} else if strings.Contains(input, "://") {
+		return ""
+	}
+	name = strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// IsArchive returns true for `.tar.gz`, `.tgz` and `.zip` archives, local or HTTP(S).
+// Directories named like archives are not archives.
+func IsArchive(input string) bool {
+	return archiveExtension(input) != "" && (isHTTPURL(input) || !IsDirectory(input))
+}
+
+type tempArchiveDirectory struct {
+	root string
+	name string
+}
+
+// Path returns a workspace directory containing the extracted archive as its only orb
+func (t *tempArchiveDirectory) Path() string {
+	return filepath.Join(t.root, "workspace")
+}
+
+func (t *tempArchiveDirectory) Name() string {
+	return t.name
+}
+
+func (t *tempArchiveDirectory) Close() error {
+	return os.RemoveAll(t.root)
+}
+
+func getArchive(input string) (srcdir SourceDirectory, err error) {
+	ext := archiveExtension(input)
+	base := input
+	if isHTTPURL(input) {
+		var u *url.URL
+		u, err = url.Parse(input)
+		if err != nil {
+			return
+		}
+		base = u.Path
+	}
+	base = path.Base(filepath.ToSlash(base))
+	name := base[:len(base)-len(ext)]
+
+	var root string
+	root, err = os.MkdirTemp("", "omnigres-archive")
+	if err != nil {
+		return
+	}
+	dir := &tempArchiveDirectory{root: root, name: name}
+	defer func() {
+		if err != nil {
+			_ = dir.Close()
+		}
+	}()
+
+	archive := input
+	if isHTTPURL(input) {
+		archive = filepath.Join(root, base)
+		err = download(input, archive)
+		if err != nil {
+			return
+		}
+	}
+
+	extracted := filepath.Join(root, "extracted")
+	err = os.Mkdir(extracted, 0o755)
+	if err != nil {
+		return
+	}
+	if ext == ".zip" {
+		err = extractZip(archive, extracted)
+	} else {
+		err = extractTarGz(archive, extracted)
+	}
+	if err != nil {
+		err = fmt.Errorf("could not extract %s: %w", input, err)
+		return
+	}
+
+	// Archives commonly wrap their contents in a single top-level directory
+	orbDir := extracted
+	var entries []os.DirEntry
+	entries, err = os.ReadDir(extracted)
+	if err != nil {
+		return
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		orbDir = filepath.Join(extracted, entries[0].Name())
+	}
+
+	err = os.MkdirAll(dir.Path(), 0o755)
+	if err != nil {
+		return
+	}
+	err = os.Rename(orbDir, filepath.Join(dir.Path(), dir.name))
+	if err != nil {
+		return
+	}
+
+	srcdir = dir
+	return
+}
+
+func download(input string, filename string) (err error) {
+	log.Debug("Downloading archive", "url", input)
+	var response *http.Response
+	response, err = archiveClient.Get(input)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status code error: %d %s", response.StatusCode, response.Status)
+		return
+	}
+	tooLarge := fmt.Errorf("archive %s is larger than %d bytes", input, maxArchiveSize)
+	if response.ContentLength > maxArchiveSize {
+		err = tooLarge
+		return
+	}
+
+	var file *os.File
+	file, err = os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	var written int64
+	written, err = io.Copy(file, io.LimitReader(response.Body, maxArchiveSize+1))
+	if err == nil && written > maxArchiveSize {
+		err = tooLarge
+	}
+	return
+}
+
+// safePath resolves an archive entry name within dir.
+//
+// It rejects names that escape dir and names that would be written through
+// a symbolic link extracted earlier.
+func safePath(dir string, name string) (target string, err error) {
+	name = filepath.FromSlash(strings.TrimPrefix(name, "./"))
+	if !filepath.IsLocal(name) {
+		err = fmt.Errorf("illegal path %s", name)
+		return
+	}
+	target = filepath.Join(dir, name)
+	for parent := filepath.Dir(target); parent != dir; parent = filepath.Dir(parent) {
+		info, statErr := os.Lstat(parent)
+		if statErr == nil && info.Mode()&os.ModeSymlink != 0 {
+			err = fmt.Errorf("illegal path %s: traverses a symbolic link", name)
+			return
+		}
+	}
+	return
+}
+
+// checkSymlink ensures the symbolic link at name points within the extraction directory
+func checkSymlink(name string, linkname string) (err error) {
+	if filepath.IsAbs(linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(filepath.FromSlash(name)), filepath.FromSlash(linkname))) {
+		err = fmt.Errorf("illegal symbolic link %s -> %s", name, linkname)
+	}
+	return
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode) (err error) {
+	err = os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return
+	}
+	var file *os.File
+	file, err = os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	_, err = io.Copy(file, r)
+	return
+}
+
+func writeSymlink(target string, linkname string) (err error) {
+	err = os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return
+	}
+	return os.Symlink(linkname, target)
+}
+
+func extractTarGz(archive string, dir string) (err error) {
+	var file *os.File
+	file, err = os.Open(archive)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var gz *gzip.Reader
+	gz, err = gzip.NewReader(file)
+	if err != nil {
+		return
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		var header *tar.Header
+		header, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		var target string
+		target, err = safePath(dir, header.Name)
+		if err != nil {
+			return
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0o755)
+		case tar.TypeReg:
+			err = writeFile(target, tr, header.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = checkSymlink(header.Name, header.Linkname)
+			if err == nil {
+				err = writeSymlink(target, header.Linkname)
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			err = fmt.Errorf("unsupported entry %s", header.Name)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func extractZip(archive string, dir string) (err error) {
+	var zr *zip.ReadCloser
+	zr, err = zip.OpenReader(archive)
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		var target string
+		target, err = safePath(dir, f.Name)
+		if err != nil {
+			return
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = os.MkdirAll(target, 0o755)
+		case mode&os.ModeSymlink != 0:
+			err = extractZipSymlink(f, target)
+		case mode.IsRegular():
+			err = extractZipFile(f, target)
+		default:
+			err = fmt.Errorf("unsupported entry %s", f.Name)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func extractZipFile(f *zip.File, target string) (err error) {
+	var r io.ReadCloser
+	r, err = f.Open()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	return writeFile(target, r, f.Mode())
+}
+
+func extractZipSymlink(f *zip.File, target string) (err error) {
+	var r io.ReadCloser
+	r, err = f.Open()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	var linkname []byte
+	linkname, err = io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = checkSymlink(f.Name, string(linkname))
+	if err != nil {
+		return
+	}
+	return writeSymlink(target, string(linkname))
+}
+
+func init() {
+	Register(NewResolver("<path or http(s) url>.tar.gz|.tgz|.zip", 30, IsArchive, getArchive))
+}
@@ -0,0 +1,222 @@
+package src
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name     string
+	body     string
+	linkname string
+	dir      bool
+}
+
+func writeTestTarGz(t *testing.T, filename string, entries []archiveEntry) {
+	t.Helper()
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(entry.body))}
+		switch {
+		case entry.dir:
+			header.Typeflag, header.Mode = tar.TypeDir, 0o755
+		case entry.linkname != "":
+			header.Typeflag, header.Linkname = tar.TypeSymlink, entry.linkname
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, filename string, entries []archiveEntry) {
+	t.Helper()
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zw := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name}
+		body := entry.body
+		switch {
+		case entry.dir:
+			header.SetMode(os.ModeDir | 0o755)
+		case entry.linkname != "":
+			header.SetMode(os.ModeSymlink | 0o777)
+			body = entry.linkname
+		default:
+			header.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetArchive(t *testing.T) {
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		t.Run(ext, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "hello"+ext)
+			entries := []archiveEntry{
+				{name: "hello-main/", dir: true},
+				{name: "hello-main/src/hello.sql", body: "select 1;"},
+				{name: "hello-main/src/link.sql", linkname: "hello.sql"},
+			}
+			if ext == ".zip" {
+				writeTestZip(t, archive, entries)
+			} else {
+				writeTestTarGz(t, archive, entries)
+			}
+
+			srcdir, err := getArchive(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srcdir.Close()
+
+			named, ok := srcdir.(NamedSourceDirectory)
+			if !ok {
+				t.Fatalf("expected a named source directory, got %T", srcdir)
+			}
+			if named.Name() != "hello" {
+				t.Errorf("expected orb hello, got %s", named.Name())
+			}
+			for _, name := range []string{"hello.sql", "link.sql"} {
+				body, err := os.ReadFile(filepath.Join(named.Path(), "hello", "src", name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(body) != "select 1;" {
+					t.Errorf("unexpected contents of %s: %q", name, body)
+				}
+			}
+
+			root := srcdir.(*tempArchiveDirectory).root
+			if err = srcdir.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = os.Stat(root); !os.IsNotExist(err) {
+				t.Errorf("expected %s to be removed", root)
+			}
+		})
+	}
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{
+			name:    "parent directory",
+			entries: []archiveEntry{{name: "../escaped", body: "x"}},
+		},
+		{
+			name:    "nested parent directory",
+			entries: []archiveEntry{{name: "orb/../../escaped", body: "x"}},
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{{name: "/tmp/escaped", body: "x"}},
+		},
+		{
+			name:    "symbolic link to parent directory",
+			entries: []archiveEntry{{name: "orb/link", linkname: "../../escaped"}},
+		},
+		{
+			name:    "absolute symbolic link",
+			entries: []archiveEntry{{name: "orb/link", linkname: "/etc/passwd"}},
+		},
+		{
+			name: "write through symbolic link",
+			entries: []archiveEntry{
+				{name: "orb/link", linkname: "."},
+				{name: "orb/link/escaped", body: "x"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		for _, ext := range []string{".tar.gz", ".zip"} {
+			t.Run(test.name+ext, func(t *testing.T) {
+				base := t.TempDir()
+				archive := filepath.Join(base, "unsafe"+ext)
+				dir := filepath.Join(base, "a", "b", "extracted")
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				var err error
+				if ext == ".zip" {
+					writeTestZip(t, archive, test.entries)
+					err = extractZip(archive, dir)
+				} else {
+					writeTestTarGz(t, archive, test.entries)
+					err = extractTarGz(archive, dir)
+				}
+				if err == nil || !strings.Contains(err.Error(), "illegal") {
+					t.Fatalf("expected an illegal entry error, got %v", err)
+				}
+
+				for _, escaped := range []string{
+					filepath.Join(base, "a", "escaped"),
+					filepath.Join(base, "a", "b", "escaped"),
+					filepath.Join(dir, "orb", "escaped"),
+				} {
+					if _, err = os.Lstat(escaped); !os.IsNotExist(err) {
+						t.Errorf("%s was written", escaped)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDownloadLimitsSize(t *testing.T) {
+	previous := maxArchiveSize
+	maxArchiveSize = 4
+	defer func() { maxArchiveSize = previous }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// chunked, so that only the body's size gives it away
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	err := download(server.URL+"/large.zip", filepath.Join(t.TempDir(), "large.zip"))
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("expected a size error, got %v", err)
+	}
+}
@@ -23,3 +23,9 @@ func (s *ExistingDirectory) Path() string {
 func (s *ExistingDirectory) Close() error {
 	return nil
 }
+
+func init() {
+	Register(NewResolver("<directory>", 10, IsDirectory, func(input string) (SourceDirectory, error) {
+		return &ExistingDirectory{directory: input}, nil
+	}))
+}
@@ -0,0 +1,140 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// IsGitURL returns true for git repository sources: `git+<url>` and
+// `file://` repositories, optionally followed by `#ref:subdir`
+func IsGitURL(input string) bool {
+	return strings.HasPrefix(input, "git+") || strings.HasPrefix(input, "file://")
+}
+
+type gitSource struct {
+	url    string
+	ref    string
+	subdir string
+}
+
+// parseGitURL splits `git+https://host/repo.git#ref:subdir` into its parts.
+// Both ref and subdir are optional.
+func parseGitURL(input string) (source gitSource, err error) {
+	url, fragment, _ := strings.Cut(strings.TrimPrefix(input, "git+"), "#")
+	source.url = url
+	source.ref, source.subdir, _ = strings.Cut(fragment, ":")
+	source.subdir = strings.Trim(source.subdir, "/")
+	switch {
+	case strings.HasPrefix(source.ref, "-"):
+		// would be taken for an option by git checkout
+		err = fmt.Errorf("invalid ref %s in %s", source.ref, input)
+	case source.subdir != "" && !filepath.IsLocal(source.subdir):
+		err = fmt.Errorf("invalid subdirectory %s in %s", source.subdir, input)
+	}
+	return
+}
+
+// name derives the orb name from the subdirectory or, if there's none, the repository
+func (g gitSource) name() string {
+	if g.subdir != "" {
+		return path.Base(g.subdir)
+	}
+	return strings.TrimSuffix(path.Base(strings.TrimRight(g.url, "/")), ".git")
+}
+
+type tempGitDirectory struct {
+	root string
+	name string
+}
+
+// Path returns a workspace directory containing the checkout as its only orb
+func (t *tempGitDirectory) Path() string {
+	return filepath.Join(t.root, "workspace")
+}
+
+func (t *tempGitDirectory) Name() string {
+	return t.name
+}
+
+func (t *tempGitDirectory) Close() error {
+	return os.RemoveAll(t.root)
+}
+
+func git(args ...string) (err error) {
+	log.Debug("Running git", "args", args)
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return
+}
+
+func getGitRepository(input string) (srcdir SourceDirectory, err error) {
+	var source gitSource
+	source, err = parseGitURL(input)
+	if err != nil {
+		return
+	}
+
+	if _, err = exec.LookPath("git"); err != nil {
+		err = fmt.Errorf("git is required to use %s: %w", input, err)
+		return
+	}
+
+	var root string
+	root, err = os.MkdirTemp("", "omnigres-git")
+	if err != nil {
+		return
+	}
+	dir := &tempGitDirectory{root: root, name: source.name()}
+	defer func() {
+		if err != nil {
+			_ = dir.Close()
+		}
+	}()
+
+	checkout := filepath.Join(root, "checkout")
+	if source.ref == "" {
+		err = git("clone", "--quiet", "--depth", "1", "--", source.url, checkout)
+	} else {
+		err = git("clone", "--quiet", "--", source.url, checkout)
+		if err == nil {
+			err = git("-C", checkout, "checkout", "--quiet", source.ref)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	orbDir := filepath.Join(checkout, filepath.FromSlash(source.subdir))
+	if !IsDirectory(orbDir) {
+		err = fmt.Errorf("%s is not a directory in %s", source.subdir, source.url)
+		return
+	}
+
+	err = os.MkdirAll(dir.Path(), 0o755)
+	if err != nil {
+		return
+	}
+	err = os.Rename(orbDir, filepath.Join(dir.Path(), dir.name))
+	if err != nil {
+		return
+	}
+
+	srcdir = dir
+	return
+}
+
+func init() {
+	Register(NewResolver("git+<url>#ref:subdir, file://<path>#ref:subdir", 20, IsGitURL, getGitRepository))
+}
@@ -0,0 +1,137 @@
+package src
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseGitURL(t *testing.T) {
+	tests := []struct {
+		input  string
+		source gitSource
+		name   string
+		fails  bool
+	}{
+		{
+			input:  "git+https://github.com/omnigres/examples.git#main:orbs/hello",
+			source: gitSource{url: "https://github.com/omnigres/examples.git", ref: "main", subdir: "orbs/hello"},
+			name:   "hello",
+		},
+		{
+			input:  "git+https://github.com/omnigres/hello.git",
+			source: gitSource{url: "https://github.com/omnigres/hello.git"},
+			name:   "hello",
+		},
+		{
+			input:  "git+https://github.com/omnigres/hello/",
+			source: gitSource{url: "https://github.com/omnigres/hello/"},
+			name:   "hello",
+		},
+		{
+			input:  "git+https://github.com/omnigres/hello.git#v1.0",
+			source: gitSource{url: "https://github.com/omnigres/hello.git", ref: "v1.0"},
+			name:   "hello",
+		},
+		{
+			// missing ref, the default branch is used
+			input:  "git+https://github.com/omnigres/examples.git#:orbs/hello/",
+			source: gitSource{url: "https://github.com/omnigres/examples.git", subdir: "orbs/hello"},
+			name:   "hello",
+		},
+		{
+			input:  "file:///tmp/repo.git#main",
+			source: gitSource{url: "file:///tmp/repo.git", ref: "main"},
+			name:   "repo",
+		},
+		{
+			input: "git+https://github.com/omnigres/hello.git#--upload-pack=touch",
+			fails: true,
+		},
+		{
+			input: "git+https://github.com/omnigres/hello.git#main:../escaped",
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			source, err := parseGitURL(test.input)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source != test.source {
+				t.Errorf("expected %+v, got %+v", test.source, source)
+			}
+			if name := source.name(); name != test.name {
+				t.Errorf("expected name %s, got %s", test.name, name)
+			}
+		})
+	}
+}
+
+func TestGetGitRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	repo := filepath.Join(t.TempDir(), "hello.git")
+	if err := os.MkdirAll(filepath.Join(repo, "orbs", "hello"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "orbs", "hello", "hello.sql"), []byte("select 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch", "main", repo},
+		{"-C", repo, "add", "."},
+		{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@localhost", "commit", "--quiet", "-m", "hello"},
+		{"-C", repo, "tag", "v1"},
+	} {
+		if err := git(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		fragment string
+		fails    bool
+	}{
+		{fragment: "#v1:orbs/hello"},
+		{fragment: "#:orbs/hello"},
+		{fragment: "#missing:orbs/hello", fails: true},
+		{fragment: "#v1:orbs/missing", fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fragment, func(t *testing.T) {
+			srcdir, err := getGitRepository("file://" + repo + test.fragment)
+			if test.fails {
+				if err == nil {
+					srcdir.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srcdir.Close()
+
+			named := srcdir.(NamedSourceDirectory)
+			if named.Name() != "hello" {
+				t.Errorf("expected name hello, got %s", named.Name())
+			}
+			if _, err = os.Stat(filepath.Join(named.Path(), named.Name(), "hello.sql")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
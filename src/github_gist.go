@@ -1,81 +1,321 @@
 package src
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/PuerkitoBio/goquery"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+
+	"github.com/charmbracelet/log"
 )
 
+// GistAPIBaseURL is the base URL of the GitHub API used to fetch gists
+var GistAPIBaseURL = "https://api.github.com"
+
+var gistURLPattern = regexp.MustCompile(`^https://gist\.github\.com/(?:[^/]+/)?([0-9a-fA-F]+)(?:/([0-9a-fA-F]{40}))?/?$`)
+
 func IsGitHubGistURL(input string) bool {
-	ok, _ := regexp.MatchString("https://gist.github.com/(.+)/(.+)", input)
-	return ok
+	return gistURLPattern.MatchString(input)
+}
+
+type gistFile struct {
+	Filename  string `json:"filename"`
+	RawURL    string `json:"raw_url"`
+	Truncated bool   `json:"truncated"`
+	Content   string `json:"content"`
+}
+
+type gist struct {
+	ID      string              `json:"id"`
+	Files   map[string]gistFile `json:"files"`
+	History []struct {
+		Version string `json:"version"`
+	} `json:"history"`
 }
 
-type tempGistDirectory struct {
+type gistDirectory struct {
 	path string
 }
 
-func (t *tempGistDirectory) Path() string {
-	return t.path
+// Path returns a workspace directory with gist's files as sources of its only orb
+func (g *gistDirectory) Path() string {
+	return g.path
 }
 
-func (t *tempGistDirectory) Close() error {
-	return os.RemoveAll(t.path)
+func (g *gistDirectory) Name() string {
+	return "gist"
 }
 
-func getGitHubGist(input string) (srcdir SourceDirectory, err error) {
+func (g *gistDirectory) Close() error {
+	return os.RemoveAll(g.path)
+}
+
+// gistCacheRoot returns the cache directory for the gist, or an empty
+// string if there's no user cache directory
+func gistCacheRoot(id string) string {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		log.Debug("No cache directory, gists won't be cached", "err", err)
+		return ""
+	}
+	return filepath.Join(cache, "omnigres", "gists", id)
+}
+
+// gistCacheDir returns the cache directory for the gist revision, or an
+// empty string if there's no user cache directory
+func gistCacheDir(id string, revision string) string {
+	root := gistCacheRoot(id)
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(root, revision)
+}
+
+// gistLatest is the latest revision of a gist seen, along with its ETag to
+// check whether it's still the latest one
+type gistLatest struct {
+	ETag     string `json:"etag"`
+	Revision string `json:"revision"`
+}
+
+func readGistLatest(id string) (latest gistLatest) {
+	root := gistCacheRoot(id)
+	if root == "" {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(root, "latest.json"))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &latest); err != nil || !IsDirectory(gistCacheDir(id, latest.Revision)) {
+		latest = gistLatest{}
+	}
+	return
+}
+
+func writeGistLatest(id string, latest gistLatest) (err error) {
+	var data []byte
+	data, err = json.Marshal(latest)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(filepath.Join(gistCacheRoot(id), "latest.json"), data, 0o644)
+}
+
+func githubGet(url string) (response *http.Response, err error) {
+	return githubGetIfNoneMatch(url, "")
+}
+
+// githubGetIfNoneMatch makes a conditional request if etag is given, in
+// which case a 304 Not Modified response is returned, too
+func githubGetIfNoneMatch(url string, etag string) (response *http.Response, err error) {
+	var request *http.Request
+	request, err = http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		return
+	}
+	notModified := etag != "" && response.StatusCode == http.StatusNotModified
+	if response.StatusCode != http.StatusOK && !notModified {
+		response.Body.Close()
+		err = fmt.Errorf("status code error fetching %s: %d %s", url, response.StatusCode, response.Status)
+	}
+	return
+}
+
+// fetchGist fetches the gist, unless it still has the given ETag
+func fetchGist(id string, revision string, etag string) (g gist, newETag string, notModified bool, err error) {
+	url := fmt.Sprintf("%s/gists/%s", GistAPIBaseURL, id)
+	if revision != "" {
+		url += "/" + revision
+	}
+	log.Debug("Fetching gist", "url", url)
 	var response *http.Response
-	response, err = http.Get(input)
+	response, err = githubGetIfNoneMatch(url, etag)
 	if err != nil {
 		return
 	}
 	defer response.Body.Close()
-	if response.StatusCode != 200 {
-		err = fmt.Errorf("status code error: %d %s", response.StatusCode, response.Status)
+	if response.StatusCode == http.StatusNotModified {
+		notModified = true
+		return
+	}
+	newETag = response.Header.Get("ETag")
+	err = json.NewDecoder(response.Body).Decode(&g)
+	return
+}
+
+// writeGistFile writes the file into dir, fetching its raw contents if the
+// API response had it truncated
+func writeGistFile(dir string, file gistFile) (err error) {
+	filename := filepath.Base(file.Filename)
+	if !filepath.IsLocal(filename) {
+		err = fmt.Errorf("illegal gist file name %s", file.Filename)
 		return
 	}
-	var doc *goquery.Document
-	doc, err = goquery.NewDocumentFromReader(response.Body)
+
+	content := io.Reader(nil)
+	if file.Truncated {
+		var response *http.Response
+		response, err = githubGet(file.RawURL)
+		if err != nil {
+			return
+		}
+		defer response.Body.Close()
+		content = response.Body
+	}
+
+	var f *os.File
+	f, err = os.Create(filepath.Join(dir, filename))
 	if err != nil {
 		return
 	}
+	defer f.Close()
+	if content != nil {
+		_, err = io.Copy(f, content)
+	} else {
+		_, err = f.WriteString(file.Content)
+	}
+	return
+}
+
+// copyCachedGist copies the cached gist into a temporary directory, so that
+// the cache itself is never handed out (and mounted into clusters)
+func copyCachedGist(cached string) (srcdir SourceDirectory, err error) {
+	log.Debug("Using cached gist", "path", cached)
 	var dir string
 	dir, err = os.MkdirTemp("", "omnigres-gist")
 	if err != nil {
 		return
 	}
+	err = os.CopyFS(dir, os.DirFS(cached))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return
+	}
+	srcdir = &gistDirectory{path: dir}
+	return
+}
 
-	doc.Find("a").Each(func(i int, s *goquery.Selection) {
-		href, _ := s.Attr("href")
-		if ok, _ := regexp.MatchString("/raw/", href); ok {
-			response, err = http.Get("https://gist.github.com" + href)
-			if err != nil {
-				return
-			}
-			defer response.Body.Close()
-			if response.StatusCode != 200 {
-				err = fmt.Errorf("status code error: %d %s", response.StatusCode, response.Status)
-				return
-			}
-			filename := filepath.Base(href)
-			var file *os.File
+// cacheGist stores the gist directory in the cache
+func cacheGist(dir string, cached string) (err error) {
+	err = os.MkdirAll(filepath.Dir(cached), 0o755)
+	if err != nil {
+		return
+	}
+	// Copied next to the cache directory first, so that an interrupted copy
+	// is never taken for a cached gist
+	var tmp string
+	tmp, err = os.MkdirTemp(filepath.Dir(cached), ".tmp")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	err = os.CopyFS(tmp, os.DirFS(dir))
+	if err != nil {
+		return
+	}
+	return os.Rename(tmp, cached)
+}
 
-			file, err = os.Create(filepath.Join(dir, filename))
-			if err != nil {
-				return
-			}
-			defer file.Close()
-			_, err = io.Copy(file, response.Body)
+func getGitHubGist(input string) (srcdir SourceDirectory, err error) {
+	match := gistURLPattern.FindStringSubmatch(input)
+	if match == nil {
+		err = fmt.Errorf("invalid gist URL %s", input)
+		return
+	}
+	id, revision := match[1], match[2]
+	pinned := revision != ""
 
-			if err != nil {
-				return
+	// A pinned revision that has been cached doesn't need to be fetched at all
+	if pinned {
+		if cached := gistCacheDir(id, revision); cached != "" && IsDirectory(cached) {
+			return copyCachedGist(cached)
+		}
+	}
+
+	// The latest revision is only fetched again if the gist has changed
+	var latest gistLatest
+	if !pinned {
+		latest = readGistLatest(id)
+	}
+
+	var g gist
+	var etag string
+	var notModified bool
+	g, etag, notModified, err = fetchGist(id, revision, latest.ETag)
+	if err != nil {
+		return
+	}
+	if notModified {
+		return copyCachedGist(gistCacheDir(id, latest.Revision))
+	}
+	if !pinned {
+		if len(g.History) == 0 {
+			err = fmt.Errorf("gist %s has no revisions", id)
+			return
+		}
+		revision = g.History[0].Version
+	}
+
+	cached := gistCacheDir(id, revision)
+	defer func() {
+		if err == nil && !pinned && etag != "" && IsDirectory(cached) {
+			if cacheErr := writeGistLatest(id, gistLatest{ETag: etag, Revision: revision}); cacheErr != nil {
+				log.Debug("Could not cache gist's ETag", "err", cacheErr)
 			}
 		}
-	})
-	srcdir = &tempGistDirectory{path: dir}
+	}()
+	if cached != "" && IsDirectory(cached) {
+		return copyCachedGist(cached)
+	}
+
+	var dir string
+	dir, err = os.MkdirTemp("", "omnigres-gist")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	sources := filepath.Join(dir, "gist", "src")
+	err = os.MkdirAll(sources, 0o755)
+	if err != nil {
+		return
+	}
+	for _, file := range g.Files {
+		err = writeGistFile(sources, file)
+		if err != nil {
+			return
+		}
+	}
+
+	if cached != "" {
+		if cacheErr := cacheGist(dir, cached); cacheErr != nil {
+			log.Debug("Could not cache gist", "err", cacheErr)
+		}
+	}
+
+	srcdir = &gistDirectory{path: dir}
 	return
 }
+
+func init() {
+	Register(NewResolver("https://gist.github.com/<user>/<id>[/<revision>]", 40, IsGitHubGistURL, getGitHubGist))
+}
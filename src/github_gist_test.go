@@ -0,0 +1,168 @@
+package src
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	testGistID       = "0123456789abcdef"
+	testGistRevision = "0123456789abcdef0123456789abcdef01234567"
+	testGistETag     = `"v1"`
+)
+
+type gistServer struct {
+	*httptest.Server
+	gistRequests   atomic.Int32
+	rawRequests    atomic.Int32
+	notModified    atomic.Int32
+	authorizations []string
+}
+
+func newGistServer(t *testing.T) *gistServer {
+	t.Helper()
+	s := &gistServer{}
+	mux := http.NewServeMux()
+	handleGist := func(w http.ResponseWriter, r *http.Request) {
+		s.gistRequests.Add(1)
+		s.authorizations = append(s.authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("If-None-Match") == testGistETag {
+			s.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", testGistETag)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id": testGistID,
+			"files": map[string]any{
+				"hello.sql": map[string]any{"filename": "hello.sql", "content": "select 1;"},
+				"big.sql": map[string]any{
+					"filename":  "big.sql",
+					"truncated": true,
+					"content":   "select",
+					"raw_url":   s.URL + "/raw/big.sql",
+				},
+			},
+			"history": []map[string]any{{"version": testGistRevision}},
+		})
+	}
+	mux.HandleFunc("/gists/"+testGistID, handleGist)
+	mux.HandleFunc("/gists/"+testGistID+"/"+testGistRevision, handleGist)
+	mux.HandleFunc("/raw/big.sql", func(w http.ResponseWriter, r *http.Request) {
+		s.rawRequests.Add(1)
+		_, _ = w.Write([]byte("select 2;"))
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	baseURL := GistAPIBaseURL
+	GistAPIBaseURL = s.URL
+	t.Cleanup(func() { GistAPIBaseURL = baseURL })
+
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	return s
+}
+
+func checkGistDirectory(t *testing.T, srcdir SourceDirectory) {
+	t.Helper()
+	named, ok := srcdir.(NamedSourceDirectory)
+	if !ok {
+		t.Fatalf("expected a named source directory, got %T", srcdir)
+	}
+	for name, expected := range map[string]string{"hello.sql": "select 1;", "big.sql": "select 2;"} {
+		body, err := os.ReadFile(filepath.Join(named.Path(), named.Name(), "src", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Errorf("unexpected contents of %s: %q", name, body)
+		}
+	}
+}
+
+func TestGetGitHubGist(t *testing.T) {
+	server := newGistServer(t)
+	t.Setenv("GITHUB_TOKEN", "secret")
+
+	srcdir, err := getGitHubGist("https://gist.github.com/someone/" + testGistID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGistDirectory(t, srcdir)
+	if server.rawRequests.Load() != 1 {
+		t.Errorf("expected the truncated file to be fetched once, got %d requests", server.rawRequests.Load())
+	}
+	if server.authorizations[0] != "Bearer secret" {
+		t.Errorf("expected the token to be sent, got %q", server.authorizations[0])
+	}
+
+	// The source directory is a copy, removing it keeps the cache intact
+	path := srcdir.Path()
+	if err = srcdir.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", path)
+	}
+	if cached := gistCacheDir(testGistID, testGistRevision); !IsDirectory(cached) {
+		t.Errorf("expected the gist to be cached in %s", cached)
+	}
+}
+
+func TestGetGitHubGistNotModified(t *testing.T) {
+	server := newGistServer(t)
+
+	for range 2 {
+		srcdir, err := getGitHubGist("https://gist.github.com/" + testGistID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGistDirectory(t, srcdir)
+		if strings.HasPrefix(srcdir.Path(), gistCacheRoot(testGistID)) {
+			t.Errorf("expected a copy of the cache, got %s", srcdir.Path())
+		}
+		_ = srcdir.Close()
+	}
+
+	if server.gistRequests.Load() != 2 || server.notModified.Load() != 1 {
+		t.Errorf("expected the gist to be checked with its ETag, got %d requests, %d not modified",
+			server.gistRequests.Load(), server.notModified.Load())
+	}
+	if server.rawRequests.Load() != 1 {
+		t.Errorf("expected files to be fetched once, got %d requests", server.rawRequests.Load())
+	}
+}
+
+func TestGetGitHubGistPinnedRevision(t *testing.T) {
+	server := newGistServer(t)
+
+	for range 2 {
+		srcdir, err := getGitHubGist("https://gist.github.com/someone/" + testGistID + "/" + testGistRevision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGistDirectory(t, srcdir)
+		_ = srcdir.Close()
+	}
+
+	if server.gistRequests.Load() != 1 {
+		t.Errorf("expected a cached revision not to be fetched again, got %d requests", server.gistRequests.Load())
+	}
+}
+
+func TestGetGitHubGistErrorStatus(t *testing.T) {
+	newGistServer(t)
+
+	_, err := getGitHubGist("https://gist.github.com/someone/fedcba9876543210")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a 404 error, got %v", err)
+	}
+}
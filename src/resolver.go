@@ -0,0 +1,77 @@
+package src
+
+import (
+	"slices"
+	"sync"
+)
+
+// SourceResolver turns inputs of a particular kind (directories, URLs, ...)
+// into source directories.
+//
+// Resolvers are consulted in order of descending priority, and the first one
+// that matches the input resolves it. Code embedding this package can
+// register its own resolvers using Register.
+type SourceResolver interface {
+	// Scheme describes the inputs accepted by the resolver, for example
+	// `git+<url>#ref:subdir`
+	Scheme() string
+	Priority() int
+	Match(input string) bool
+	Resolve(input string) (SourceDirectory, error)
+}
+
+type funcResolver struct {
+	scheme   string
+	priority int
+	match    func(string) bool
+	resolve  func(string) (SourceDirectory, error)
+}
+
+func (r *funcResolver) Scheme() string {
+	return r.scheme
+}
+
+func (r *funcResolver) Priority() int {
+	return r.priority
+}
+
+func (r *funcResolver) Match(input string) bool {
+	return r.match(input)
+}
+
+func (r *funcResolver) Resolve(input string) (SourceDirectory, error) {
+	return r.resolve(input)
+}
+
+// NewResolver creates a resolver out of a pair of functions
+func NewResolver(
+	scheme string,
+	priority int,
+	match func(input string) bool,
+	resolve func(input string) (SourceDirectory, error),
+) SourceResolver {
+	return &funcResolver{scheme: scheme, priority: priority, match: match, resolve: resolve}
+}
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   []SourceResolver
+)
+
+// Register adds a resolver to the registry. Resolvers with equal priority
+// are consulted in the order of registration.
+func Register(resolver SourceResolver) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	resolvers = append(resolvers, resolver)
+	slices.SortStableFunc(resolvers, func(a, b SourceResolver) int {
+		return b.Priority() - a.Priority()
+	})
+}
+
+// Resolvers returns registered resolvers in the order they are consulted
+func Resolvers() []SourceResolver {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	return slices.Clone(resolvers)
+}
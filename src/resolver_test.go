@@ -0,0 +1,56 @@
+package src
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolversOrder(t *testing.T) {
+	expected := []int{40, 30, 20, 10}
+	resolvers := Resolvers()
+	if len(resolvers) != len(expected) {
+		t.Fatalf("expected %d resolvers, got %d", len(expected), len(resolvers))
+	}
+	for i, resolver := range resolvers {
+		if resolver.Priority() != expected[i] {
+			t.Errorf("expected resolver %d (%s) to have priority %d, got %d",
+				i, resolver.Scheme(), expected[i], resolver.Priority())
+		}
+	}
+}
+
+func TestResolverMatch(t *testing.T) {
+	base := t.TempDir()
+	dirNamedLikeArchive := filepath.Join(base, "foo.zip")
+	if err := os.Mkdir(dirNamedLikeArchive, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		priority int
+	}{
+		{input: "https://gist.github.com/user/0123456789abcdef", priority: 40},
+		{input: "https://example.com/hello.tar.gz", priority: 30},
+		{input: filepath.Join(base, "hello.zip"), priority: 30},
+		{input: "git+https://github.com/omnigres/hello.git", priority: 20},
+		{input: dirNamedLikeArchive, priority: 10},
+		{input: base, priority: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			for _, resolver := range Resolvers() {
+				if resolver.Match(test.input) {
+					if resolver.Priority() != test.priority {
+						t.Errorf("expected the resolver with priority %d, got %s (%d)",
+							test.priority, resolver.Scheme(), resolver.Priority())
+					}
+					return
+				}
+			}
+			t.Errorf("no resolver matches %s", test.input)
+		})
+	}
+}
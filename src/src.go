@@ -10,13 +10,19 @@ type SourceDirectory interface {
 	io.Closer
 }
 
+// NamedSourceDirectory is a source directory that knows the name of the orb
+// it contains. Its path is a workspace with the orb in a directory of that name.
+type NamedSourceDirectory interface {
+	SourceDirectory
+	Name() string
+}
+
 func GetSourceDirectory(input string) (src SourceDirectory, err error) {
-	if IsGitHubGistURL(input) {
-		return getGitHubGist(input)
-	} else if IsDirectory(input) {
-		src = &ExistingDirectory{directory: input}
-	} else {
-		err = fmt.Errorf("Invalid source `%s`. Is this a valid, existing directory?", input)
+	for _, resolver := range Resolvers() {
+		if resolver.Match(input) {
+			return resolver.Resolve(input)
+		}
 	}
+	err = fmt.Errorf("Invalid source `%s`. Is this a valid, existing directory?", input)
 	return
 }
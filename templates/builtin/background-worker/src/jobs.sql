@@ -0,0 +1,32 @@
+create table jobs
+(
+    id          serial primary key,
+    payload     jsonb       not null,
+    created_at  timestamptz not null default now(),
+    finished_at timestamptz
+);
+
+-- Processes a batch of pending jobs, skipping those locked by
+-- concurrently running workers
+create procedure process_jobs(batch_size int default 10)
+    language plpgsql
+as
+$$
+declare
+    job jobs;
+begin
+    for job in select *
+               from jobs
+               where finished_at is null
+               order by id
+               limit batch_size for update skip locked
+        loop
+            raise notice '{{ .Orb }}: processing job %', job.id;
+            update jobs set finished_at = now() where id = job.id;
+        end loop;
+end;
+$$;
+
+-- pg_cron is installed from the orb's extensions in omnigres.yaml;
+-- scheduling a job under an existing name replaces it
+select cron.schedule('{{ .Orb }}-jobs', '* * * * *', 'call process_jobs()');
@@ -0,0 +1,10 @@
+create extension omni_httpd cascade;
+
+create function my_handler(request omni_httpd.http_request)
+  returns omni_httpd.http_outcome
+  return omni_httpd.http_response(body => 'Hello World from {{ .Orb }}');
+
+create table my_router (like omni_httpd.urlpattern_router);
+
+insert into my_router (match, handler)
+values (omni_httpd.urlpattern('/'), 'my_handler'::regproc);
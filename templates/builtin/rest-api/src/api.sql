@@ -0,0 +1,18 @@
+create extension omni_httpd cascade;
+create extension omni_rest cascade;
+
+-- Exposes tables in the public schema as a PostgREST-compatible API,
+-- e.g. GET /todos?completed=eq.false
+create procedure api_handler(request omni_httpd.http_request, outcome inout omni_httpd.http_outcome)
+    language plpgsql
+as
+$$
+begin
+    call omni_rest.postgrest(request, outcome);
+end;
+$$;
+
+create table api_router (like omni_httpd.urlpattern_router);
+
+insert into api_router (match, handler)
+values (omni_httpd.urlpattern('/*'), 'api_handler'::regproc);
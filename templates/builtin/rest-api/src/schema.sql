@@ -0,0 +1,9 @@
+create table todos
+(
+    id        serial primary key,
+    title     text    not null,
+    completed boolean not null default false
+);
+
+insert into todos (title)
+values ('Try out {{ .Orb }}');
@@ -0,0 +1,187 @@
+// Package templates provides project templates used to scaffold new orbs
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+//go:embed all:builtin
+var builtin embed.FS
+
+// Vars are the variables available to templates
+type Vars struct {
+	// Orb is the name of the orb being created
+	Orb string
+	// Workspace is the name of the workspace directory
+	Workspace string
+}
+
+// Builtin returns the names of built-in templates
+func Builtin() (names []string) {
+	entries, _ := builtin.ReadDir("builtin")
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return
+}
+
+// IsBuiltin returns true if there's a built-in template with this name
+func IsBuiltin(name string) bool {
+	return slices.Contains(Builtin(), name)
+}
+
+// BuiltinFS returns the file system of a built-in template
+func BuiltinFS(name string) (fs.FS, error) {
+	if !IsBuiltin(name) {
+		return nil, fmt.Errorf("unknown template %s", name)
+	}
+	return fs.Sub(builtin, filepath.ToSlash(filepath.Join("builtin", name)))
+}
+
+// Render renders the template into the orb directory.
+//
+// Template variables are substituted both in file contents and file names.
+// Templates are laid out as orb directories; a template without `src`
+// directory (such as a gist) is treated as a collection of source files
+// and is rendered into the orb's `src`. Existing files are never overwritten.
+// The template's omnigres.yaml is read by LoadConfig instead.
+func Render(fsys fs.FS, orbDir string, vars Vars) (err error) {
+	target := orbDir
+	if info, statErr := fs.Stat(fsys, "src"); statErr != nil || !info.IsDir() {
+		target = filepath.Join(orbDir, "src")
+	}
+
+	return fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+		if entry.Name() == ".git" || path == "omnigres.yaml" {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		var name string
+		name, err = expand(path, filepath.ToSlash(path), vars)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("template path %s expands outside of the orb directory", path)
+		}
+		dest := filepath.Join(target, filepath.FromSlash(name))
+
+		if entry.IsDir() {
+			return os.MkdirAll(dest, 0o755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		var content []byte
+		content, err = fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		var rendered string
+		rendered, err = expand(path, string(content), vars)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(dest), 0o755)
+		if err != nil {
+			return err
+		}
+		var file *os.File
+		file, err = os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s already exists", dest)
+		}
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = file.WriteString(rendered)
+		return err
+	})
+}
+
+// Config is what a template asks of the orb's configuration. It's read from
+// the template's omnigres.yaml, which is not rendered into the orb:
+//
+//	extensions: [pg_cron]
+//	postgres:
+//	  shared_preload_libraries: pg_cron
+type Config struct {
+	// Extensions are added to the orb's extensions
+	Extensions []string
+	// Postgres are added to the workspace's postgresql.conf parameters
+	Postgres map[string]string
+}
+
+// LoadConfig reads the template's omnigres.yaml, substituting template
+// variables. Templates without one ask for nothing.
+func LoadConfig(fsys fs.FS, vars Vars) (cfg Config, err error) {
+	var content []byte
+	content, err = fs.ReadFile(fsys, "omnigres.yaml")
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var rendered string
+	rendered, err = expand("omnigres.yaml", string(content), vars)
+	if err != nil {
+		return
+	}
+
+	// Postgres parameter names may contain dots
+	v := viper.NewWithOptions(viper.KeyDelimiter("::"))
+	v.SetConfigType("yaml")
+	err = v.ReadConfig(strings.NewReader(rendered))
+	if err != nil {
+		err = fmt.Errorf("invalid template omnigres.yaml: %w", err)
+		return
+	}
+	err = v.Unmarshal(&cfg)
+	return
+}
+
+func expand(name string, text string, vars Vars) (result string, err error) {
+	if !strings.Contains(text, "{{") {
+		result = text
+		return
+	}
+	var tmpl *template.Template
+	tmpl, err = template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, vars)
+	if err != nil {
+		return
+	}
+	result = buf.String()
+	return
+}
@@ -1,8 +1,8 @@
 package tui
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -12,151 +12,61 @@ import (
 )
 
 // DownloadStatus is the top-level structure of the JSON on each line of the docker output
-//
-// This can be used to define onProgress callbacks when creating a new DownloadProgress TUI
 type DownloadStatus struct {
 	Status         string         `json:"status"`
 	ProgressDetail progressDetail `json:"progressDetail"`
 	ID             string         `json:"id"`
+	Error          string         `json:"error"`
 }
 type progressDetail struct {
 	Current *int `json:"current"`
 	Total   *int `json:"total"`
 }
 
-type dockerProgressWriter struct {
-	reader      io.ReadCloser
-	layers      int
-	downloaded  int
-	downloads   map[string]float64
-	onProgress  func(int, int, float64, DownloadStatus)
-	onError     func(error)
-	onJsonParse func(DownloadStatus)
-	onFinish    func()
-}
-
 type quitMsg struct{}
-type progressMsg float64
+type doneMsg struct{}
+type pullMsg PullProgress
 type progressErrMsg struct{ err error }
-type debugMsg string
 type Model struct {
 	header   string
-	progress progress.Model
-	writer   *dockerProgressWriter
+	download progress.Model
+	extract  progress.Model
+	pull     PullProgress
+	expanded bool
 	Err      error
-	debug    string
-}
-
-var teaProgram *tea.Program
-
-// Start will copy the reader output to the DockerProgressWriter.
-//
-// This function is called in a goroutine so we don't block the TUI.
-func (pw *dockerProgressWriter) Start() {
-	_, err := io.Copy(pw, pw.reader)
-	if err != nil {
-		pw.onError(err)
-	}
 }
 
 // NewDownloadProgress returns a bubbletea TUI that tracks the progress of the given reader.
 //
-// It assumes the reader outputs the docker progress JSON messages.
-func NewDownloadProgress(initialHeader string, reader io.ReadCloser) *tea.Program {
-	writer := newDockerProgressWriter(
-		reader,
-		func(err error) { teaProgram.Send(progressErrMsg{err}) },
-		func(slice int, totalSlices int, downloadsInFlight float64, details DownloadStatus) {
-			teaProgram.Send(progressMsg((float64(slice) + downloadsInFlight) / float64(totalSlices)))
-		},
-		func(details DownloadStatus) {
-			// Uncomment to see each output line below the progres bar
-			// encodedDetails, _ := json.Marshal(details)
-			// teaProgram.Send(debugMsg(string(encodedDetails)))
-		},
-		func() {
-			teaProgram.Send(quitMsg{})
-		},
-	)
-	teaProgram = tea.NewProgram(
+// It assumes the reader outputs the docker progress JSON messages. Download
+// and extract phases are displayed separately and, with options.Layers, the
+// state of every layer is listed.
+func NewDownloadProgress(initialHeader string, reader io.ReadCloser, options ProgressOptions) *tea.Program {
+	var program *tea.Program
+	tracker := newPullTracker(reader, func(p PullProgress) {
+		program.Send(pullMsg(p))
+	})
+	program = tea.NewProgram(
 		Model{
 			header:   initialHeader,
-			progress: progress.New(progress.WithDefaultGradient()),
-			writer:   writer,
+			download: progress.New(progress.WithDefaultGradient()),
+			extract:  progress.New(progress.WithDefaultGradient()),
+			expanded: options.Layers,
 		},
 	)
-	go writer.Start()
-	return teaProgram
-}
-
-func newDockerProgressWriter(
-	reader io.ReadCloser,
-	onError func(error),
-	onProgress func(int, int, float64, DownloadStatus),
-	onJsonParse func(DownloadStatus),
-	onFinish func(),
-) *dockerProgressWriter {
-	return &dockerProgressWriter{
-		reader:      reader,
-		layers:      0,
-		downloaded:  0,
-		downloads:   map[string]float64{},
-		onError:     onError,
-		onProgress:  onProgress,
-		onJsonParse: onJsonParse,
-		onFinish:    onFinish,
-	}
-}
-
-func (cw *dockerProgressWriter) Write(payload []byte) (n int, jsonError error) {
-	lines := strings.Split(string(payload), "\n")
-	for _, line := range lines {
-		var status DownloadStatus
-		progressParseError := json.Unmarshal([]byte(line), &status)
-		if progressParseError == nil {
-			// useful for debugging
-			cw.onJsonParse(status)
-
-			switch status.Status {
-			case "Downloading":
-				var downloadProgress float64
-				if status.ProgressDetail.Current != nil && status.ProgressDetail.Total != nil && *status.ProgressDetail.Total > 0 {
-					downloadProgress = float64(*status.ProgressDetail.Current) / float64(*status.ProgressDetail.Total)
-				} else {
-					downloadProgress = 0
-				}
-				cw.downloads[status.ID] = downloadProgress
-
-				// Sums all download progress in flight for finer grained progress
-				totalDownload := 0.0
-				for _, value := range cw.downloads {
-					totalDownload += value
-				}
-				cw.onProgress(cw.downloaded, cw.layers, totalDownload, status)
-				break
-			case "Pulling fs layer":
-				cw.layers++
-				break
-			case "Download complete":
-				delete(cw.downloads, status.ID)
-				cw.downloaded++
-				break
-			case "Already exists":
-				cw.layers++
-				cw.downloaded++
-				break
-			default:
-				if strings.Contains(status.Status, "Status: Downloaded newer image") {
-					cw.onProgress(cw.layers, cw.layers, 0.0, status)
-					// we need to sleep to ensure the TUI has time to animate the progress bar
-					// specially in cases where we have only one small image to download
-					time.Sleep(time.Second)
-					cw.onFinish()
-				}
-			}
+	go func() {
+		err := tracker.Run()
+		if err != nil {
+			program.Send(progressErrMsg{err})
+			return
 		}
-	}
-	return len(payload), nil
+		program.Send(doneMsg{})
+		// we need to sleep to ensure the TUI has time to animate the progress bar
+		// specially in cases where we have only one small image to download
+		time.Sleep(500 * time.Millisecond)
+		program.Send(quitMsg{})
+	}()
+	return program
 }
 
 func (m Model) Init() tea.Cmd {
@@ -179,52 +89,83 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.WindowSizeMsg:
-		m.progress.Width = msg.Width - padding*2 - 4
-		if m.progress.Width > maxWidth {
-			m.progress.Width = maxWidth
+		width := msg.Width - padding*2 - 14
+		if width > maxWidth {
+			width = maxWidth
 		}
+		m.download.Width = width
+		m.extract.Width = width
 		return m, nil
 
 	case progressErrMsg:
 		m.Err = msg.err
 		return m, tea.Quit
 
-	case debugMsg:
-		m.debug = string(msg)
-		return m, nil
-
 	case quitMsg:
 		return m, tea.Quit
 
-	case progressMsg:
-		cmd := m.progress.SetPercent(float64(msg))
-		return m, cmd
+	case pullMsg:
+		m.pull = PullProgress(msg)
+		return m, tea.Batch(
+			m.download.SetPercent(m.pull.DownloadFraction()),
+			m.extract.SetPercent(m.pull.ExtractFraction()),
+		)
+
+	case doneMsg:
+		m.pull.ETA = 0
+		return m, tea.Batch(m.download.SetPercent(1.0), m.extract.SetPercent(1.0))
 
 	// FrameMsg is sent when the progress bar wants to animate itself
 	case progress.FrameMsg:
-		progressModel, cmd := m.progress.Update(msg)
-		m.progress = progressModel.(progress.Model)
-		return m, cmd
+		downloadModel, downloadCmd := m.download.Update(msg)
+		m.download = downloadModel.(progress.Model)
+		extractModel, extractCmd := m.extract.Update(msg)
+		m.extract = extractModel.(progress.Model)
+		return m, tea.Batch(downloadCmd, extractCmd)
 
 	default:
 		return m, nil
 	}
 }
 
+// layerLine describes the layer's status and size
+func layerLine(layer LayerProgress) string {
+	var size string
+	switch {
+	case layer.Status == "Downloading":
+		size = fmt.Sprintf("%s / %s", formatBytes(layer.Downloaded), formatBytes(layer.Size))
+	case layer.Status == "Extracting":
+		size = fmt.Sprintf("%s / %s", formatBytes(layer.Extracted), formatBytes(layer.Size))
+	case layer.Size > 0:
+		size = formatBytes(layer.Size)
+	}
+	return fmt.Sprintf("%-12s  %-18s  %s", layer.ID, layer.Status, size)
+}
+
 func (m Model) View() string {
 	if m.Err != nil {
 		return "Error downloading: " + m.Err.Error() + "\n"
 	}
 	pad := strings.Repeat(" ", padding)
 
+	layers := ""
+	if m.expanded {
+		for _, layer := range m.pull.Layers {
+			layers += pad + layerLine(layer) + "\n"
+		}
+		layers += "\n"
+	}
+
 	almostThere := ""
-	if m.progress.Percent() == 1.0 {
+	if m.extract.Percent() == 1.0 {
 		almostThere = pad + "Finishing download verification. "
 	}
 	return "\n" +
 		pad + m.header + "\n\n" +
-		pad + m.progress.View() + "\n\n" +
+		pad + "Download  " + m.download.View() + "\n" +
+		pad + "Extract   " + m.extract.View() + "\n\n" +
+		pad + m.pull.Summary() + "\n\n" +
+		layers +
 		almostThere +
-		pad + "Press ESC to abort download.\n\n" +
-		pad + m.debug
+		pad + "Press ESC to abort download.\n\n"
 }
@@ -0,0 +1,159 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ProgressOptions control how download progress is reported
+type ProgressOptions struct {
+	// NoTUI reports progress as plain text even when running in a terminal
+	NoTUI bool
+	// JSON reports progress as JSON events, one per line (implies NoTUI)
+	JSON bool
+	// Layers additionally reports the state of every layer
+	Layers bool
+	// Output is where plain text progress is written to, defaults to stdout
+	Output io.Writer
+	// Interval is the minimum time between two progress lines, defaults to 5 seconds
+	Interval time.Duration
+}
+
+// ProgressEvent is a progress report emitted in JSON mode
+type ProgressEvent struct {
+	Event  string `json:"event"`
+	Header string `json:"header,omitempty"`
+	// Phase is either "download" or "extract"
+	Phase          string  `json:"phase,omitempty"`
+	Percent        float64 `json:"percent"`
+	Bytes          int64   `json:"bytes,omitempty"`
+	TotalBytes     int64   `json:"total_bytes,omitempty"`
+	BytesPerSecond float64 `json:"bytes_per_second,omitempty"`
+	ETASeconds     float64 `json:"eta_seconds,omitempty"`
+	Layer          string  `json:"layer,omitempty"`
+	Status         string  `json:"status,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// ShowDownloadProgress reports the progress of a docker pull until it's done.
+//
+// The interactive TUI is used when stdout is a terminal, unless disabled in
+// options; otherwise progress is reported as plain text or JSON lines.
+// Errors reported by docker are returned.
+func ShowDownloadProgress(header string, reader io.ReadCloser, options ProgressOptions) (err error) {
+	if !options.NoTUI && !options.JSON && term.IsTerminal(int(os.Stdout.Fd())) {
+		var model any
+		model, err = NewDownloadProgress(header, reader, options).Run()
+		if err != nil {
+			return
+		}
+		return model.(Model).Err
+	}
+	return newPlainProgress(header, options).run(reader)
+}
+
+type plainProgress struct {
+	header  string
+	options ProgressOptions
+	// reported is the last reported percentage per phase
+	reported map[string]float64
+	last     time.Time
+	// statuses are last reported layer statuses
+	statuses map[string]string
+}
+
+func newPlainProgress(header string, options ProgressOptions) *plainProgress {
+	if options.Output == nil {
+		options.Output = os.Stdout
+	}
+	if options.Interval == 0 {
+		options.Interval = 5 * time.Second
+	}
+	return &plainProgress{
+		header:   header,
+		options:  options,
+		reported: map[string]float64{"download": -1, "extract": -1},
+		statuses: map[string]string{},
+	}
+}
+
+func (p *plainProgress) emit(event ProgressEvent, summary string) {
+	if p.options.JSON {
+		event.Header = p.header
+		encoded, _ := json.Marshal(event)
+		fmt.Fprintln(p.options.Output, string(encoded))
+		return
+	}
+	switch event.Event {
+	case "start":
+		fmt.Fprintln(p.options.Output, p.header)
+	case "progress":
+		fmt.Fprintf(p.options.Output, "  %-8s %3.0f%%  %s\n", event.Phase, event.Percent, summary)
+	case "layer":
+		fmt.Fprintf(p.options.Output, "  %s\n", summary)
+	case "done":
+		fmt.Fprintln(p.options.Output, "  done")
+	case "error":
+		fmt.Fprintf(p.options.Output, "  failed: %s\n", event.Error)
+	}
+}
+
+// phase reports the phase percentage, throttled to a line per interval
+// (or whenever it crosses a multiple of 10%)
+func (p *plainProgress) phase(name string, fraction float64, pull PullProgress) {
+	percent := math.Floor(fraction * 100)
+	reported := p.reported[name]
+	if percent <= reported {
+		return
+	}
+	if time.Since(p.last) < p.options.Interval && math.Floor(percent/10) == math.Floor(reported/10) {
+		return
+	}
+	p.reported[name] = percent
+	p.last = time.Now()
+
+	event := ProgressEvent{Event: "progress", Phase: name, Percent: percent}
+	summary := ""
+	if name == "download" {
+		event.Bytes, event.TotalBytes = pull.Downloaded, pull.DownloadTotal
+		event.BytesPerSecond, event.ETASeconds = pull.BytesPerSecond, pull.ETA.Seconds()
+		summary = pull.Summary()
+	} else {
+		event.Bytes, event.TotalBytes = pull.Extracted, pull.ExtractTotal
+		summary = fmt.Sprintf("%s / %s", formatBytes(pull.Extracted), formatBytes(pull.ExtractTotal))
+	}
+	p.emit(event, summary)
+}
+
+func (p *plainProgress) update(pull PullProgress) {
+	if p.options.Layers {
+		for _, layer := range pull.Layers {
+			if p.statuses[layer.ID] == layer.Status {
+				continue
+			}
+			p.statuses[layer.ID] = layer.Status
+			p.emit(ProgressEvent{Event: "layer", Layer: layer.ID, Status: layer.Status, TotalBytes: layer.Size}, layerLine(layer))
+		}
+	}
+	p.phase("download", pull.DownloadFraction(), pull)
+	if pull.Extracted > 0 {
+		p.phase("extract", pull.ExtractFraction(), pull)
+	}
+}
+
+func (p *plainProgress) run(reader io.ReadCloser) (err error) {
+	p.emit(ProgressEvent{Event: "start"}, "")
+	err = newPullTracker(reader, p.update).Run()
+	if err != nil {
+		p.emit(ProgressEvent{Event: "error", Error: err.Error()}, "")
+		return
+	}
+	p.emit(ProgressEvent{Event: "done", Percent: 100}, "")
+	return
+}
@@ -0,0 +1,219 @@
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// LayerProgress is the state of a single image layer being pulled
+type LayerProgress struct {
+	ID     string
+	Status string
+	// Size is the (compressed) size of the layer, 0 if not known yet
+	Size       int64
+	Downloaded int64
+	Extracted  int64
+	// Complete is set once the layer has been extracted (or already existed)
+	Complete bool
+}
+
+// PullProgress is a snapshot of the progress of an image pull
+type PullProgress struct {
+	// Layers in the order docker first reported them
+	Layers []LayerProgress
+	// Downloaded and DownloadTotal are byte counts across all layers.
+	// Sizes of layers that haven't started downloading are estimated.
+	Downloaded    int64
+	DownloadTotal int64
+	Extracted     int64
+	ExtractTotal  int64
+	// BytesPerSecond is the average download throughput so far
+	BytesPerSecond float64
+	// ETA is the estimated time remaining until the download is done
+	ETA time.Duration
+}
+
+// DownloadFraction is the download phase progress between 0 and 1
+func (p PullProgress) DownloadFraction() float64 {
+	if p.DownloadTotal == 0 {
+		return 0
+	}
+	return float64(p.Downloaded) / float64(p.DownloadTotal)
+}
+
+// ExtractFraction is the extract phase progress between 0 and 1
+func (p PullProgress) ExtractFraction() float64 {
+	if p.ExtractTotal == 0 {
+		return 0
+	}
+	return float64(p.Extracted) / float64(p.ExtractTotal)
+}
+
+// Summary is a one-line description of the throughput and ETA
+func (p PullProgress) Summary() string {
+	s := fmt.Sprintf("%s / %s", formatBytes(p.Downloaded), formatBytes(p.DownloadTotal))
+	if p.BytesPerSecond > 0 {
+		s += fmt.Sprintf(", %s/s", formatBytes(int64(p.BytesPerSecond)))
+	}
+	if eta := p.ETA.Round(time.Second); eta > 0 {
+		s += fmt.Sprintf(", ETA %s", eta)
+	}
+	return s
+}
+
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// pullTracker consumes docker's pull JSON stream and tracks byte-based
+// progress of every layer
+type pullTracker struct {
+	reader   io.Reader
+	layers   map[string]*LayerProgress
+	order    []string
+	started  time.Time
+	onUpdate func(PullProgress)
+}
+
+func newPullTracker(reader io.Reader, onUpdate func(PullProgress)) *pullTracker {
+	return &pullTracker{
+		reader:   reader,
+		layers:   map[string]*LayerProgress{},
+		onUpdate: onUpdate,
+	}
+}
+
+// Run consumes the stream until it ends, returning errors reported by docker
+func (t *pullTracker) Run() (err error) {
+	decoder := json.NewDecoder(t.reader)
+	for {
+		var status DownloadStatus
+		err = decoder.Decode(&status)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+		if status.Error != "" {
+			return errors.New(status.Error)
+		}
+		if t.update(status) {
+			t.onUpdate(t.snapshot())
+		}
+	}
+}
+
+func (t *pullTracker) layer(id string) *LayerProgress {
+	layer, ok := t.layers[id]
+	if !ok {
+		layer = &LayerProgress{ID: id}
+		t.layers[id] = layer
+		t.order = append(t.order, id)
+	}
+	return layer
+}
+
+// update applies the status to the layer it refers to and returns true if
+// the progress has changed
+func (t *pullTracker) update(status DownloadStatus) bool {
+	if status.ID == "" || strings.HasPrefix(status.Status, "Pulling from") {
+		return false
+	}
+	layer := t.layer(status.ID)
+	layer.Status = status.Status
+
+	detail := status.ProgressDetail
+	switch status.Status {
+	case "Downloading":
+		if t.started.IsZero() {
+			t.started = time.Now()
+		}
+		if detail.Total != nil && *detail.Total > 0 {
+			layer.Size = int64(*detail.Total)
+		}
+		if detail.Current != nil {
+			layer.Downloaded = int64(*detail.Current)
+		}
+	case "Download complete", "Verifying Checksum":
+		layer.Downloaded = layer.Size
+	case "Extracting":
+		layer.Downloaded = layer.Size
+		if detail.Total != nil && *detail.Total > 0 && layer.Size == 0 {
+			layer.Size = int64(*detail.Total)
+			layer.Downloaded = layer.Size
+		}
+		if detail.Current != nil {
+			layer.Extracted = int64(*detail.Current)
+		}
+	case "Pull complete":
+		layer.Downloaded = layer.Size
+		layer.Extracted = layer.Size
+		layer.Complete = true
+	case "Already exists":
+		layer.Complete = true
+	}
+	return true
+}
+
+func (t *pullTracker) snapshot() (p PullProgress) {
+	// Layers that haven't started downloading yet are assumed to be of
+	// average size, so that the total doesn't jump as they start
+	var known, knownCount, unknownCount int64
+	for _, id := range t.order {
+		layer := t.layers[id]
+		if layer.Status == "Already exists" {
+			continue
+		}
+		if layer.Size > 0 {
+			known += layer.Size
+			knownCount++
+		} else {
+			unknownCount++
+		}
+	}
+	var estimate int64
+	if knownCount > 0 {
+		estimate = known / knownCount
+	}
+
+	for _, id := range t.order {
+		layer := *t.layers[id]
+		p.Layers = append(p.Layers, layer)
+		if layer.Status == "Already exists" {
+			continue
+		}
+		size := layer.Size
+		if size == 0 {
+			size = estimate
+		}
+		p.DownloadTotal += size
+		p.ExtractTotal += size
+		p.Downloaded += layer.Downloaded
+		p.Extracted += layer.Extracted
+	}
+
+	if !t.started.IsZero() {
+		elapsed := time.Since(t.started).Seconds()
+		if elapsed > 0 {
+			p.BytesPerSecond = float64(p.Downloaded) / elapsed
+		}
+		if p.BytesPerSecond > 0 && p.DownloadTotal > p.Downloaded {
+			p.ETA = time.Duration(float64(p.DownloadTotal-p.Downloaded) / p.BytesPerSecond * float64(time.Second))
+		}
+	}
+	return
+}